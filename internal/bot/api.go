@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goVkBot/internal/retry"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Error codes of the VK API that callers may want to handle specially.
+// The full list is available at https://dev.vk.com/reference/errors
+const (
+	ErrorCodeUnknown          = 1
+	ErrorCodeAuthorization    = 5
+	ErrorCodeTooManyRequests  = 6
+	ErrorCodeInternal         = 10
+	ErrorCodeAccessDenied     = 15
+	ErrorCodeFlood            = 9
+	ErrorCodeInvalidParameter = 100
+	ErrorCodeCantSendToUser   = 901
+)
+
+// VKError is an error returned by the VK API in the "error" field of the response.
+// Errors of the calls made by the execute method carry the name of the method instead of the request params.
+type VKError struct {
+	Code          int            `json:"error_code"`
+	Message       string         `json:"error_msg"`
+	RequestParams []RequestParam `json:"request_params"`
+	Method        string         `json:"method,omitempty"`
+}
+
+// RequestParam is a request parameter echoed back by the VK API along with an error.
+type RequestParam struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Error returns the error code, message and the called method if VK reported it.
+func (e *VKError) Error() string {
+	for _, param := range e.RequestParams {
+		if param.Key == "method" {
+			return fmt.Sprintf("vk api error %d in %s: %s", e.Code, param.Value, e.Message)
+		}
+	}
+	if e.Method != "" {
+		return fmt.Sprintf("vk api error %d in %s: %s", e.Code, e.Method, e.Message)
+	}
+	return fmt.Sprintf("vk api error %d: %s", e.Code, e.Message)
+}
+
+// IsErrorCode reports whether err is, or wraps, a VK API error with the given code.
+func IsErrorCode(err error, code int) bool {
+	var vkErr *VKError
+	return errors.As(err, &vkErr) && vkErr.Code == code
+}
+
+// Call calls the VK API method and decodes the "response" field of the answer into result.
+//
+// Parameters:
+//   - ctx: The context the request is bound to.
+//   - method: The name of the VK API method, e.g. "messages.send".
+//   - params: The parameters of the method, the access token and API version are added automatically.
+//   - result: A pointer the response is unmarshaled into, or nil if the response is not needed.
+//
+// Returns:
+//   - error: A *VKError if VK answered with an error, otherwise an error describing what went wrong
+//     with the request or the response.
+//
+// Note:
+//   - Every request waits for the bot's rate limiter first, so the bot stays within the VK request limits.
+//   - Network errors, 5xx responses and responses that aren't valid JSON are retried according to the bot's
+//     retry policy, as well as ErrorCodeTooManyRequests and ErrorCodeInternal returned by the VK API.
+//     Other errors returned by the VK API are not retried.
+func (b *Bot) Call(ctx context.Context, method string, params url.Values, result interface{}) error {
+	response, err := b.call(ctx, method, params)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(response.Response, result); err != nil {
+		return fmt.Errorf("error unmarshalling %s result: %w", method, err)
+	}
+	return nil
+}
+
+// envelope is the body of a VK API response.
+type envelope struct {
+	Response      json.RawMessage `json:"response"`
+	Error         *VKError        `json:"error"`
+	ExecuteErrors []*VKError      `json:"execute_errors"`
+}
+
+// call makes the request for Call and returns the whole decoded response body.
+// It returns an error if the request failed or VK answered with an error.
+// The parameters are sent form-encoded in the request body, so the access token and the message texts
+// never appear in the URL, where they would end up in proxy logs and hit URL length limits.
+func (b *Bot) call(ctx context.Context, method string, params url.Values) (envelope, error) {
+	form := url.Values{}
+	for key, values := range params {
+		form[key] = values
+	}
+	form.Set("access_token", b.AccessToken)
+	form.Set("v", b.Client.APIVersion)
+	encodedForm := form.Encode()
+	methodUrl := b.Client.BaseURL + "/" + method
+
+	var body envelope
+	err := b.Retry.Do(ctx, func() error {
+		if err := b.Limiter.Wait(ctx); err != nil {
+			return retry.Permanent(err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, methodUrl, strings.NewReader(encodedForm))
+		if err != nil {
+			return retry.Permanent(fmt.Errorf("error creating %s request: %w", method, err))
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := b.Client.HTTPClient().Do(req)
+		if err != nil {
+			return fmt.Errorf("error calling %s: %w", method, err)
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("error reading %s response: %w", method, err)
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("unexpected %s response status: %s", method, resp.Status)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return retry.Permanent(fmt.Errorf("unexpected %s response status: %s", method, resp.Status))
+		}
+
+		body = envelope{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			return fmt.Errorf("error unmarshalling %s response: %w", method, err)
+		}
+		if body.Error != nil {
+			body.Error.RequestParams = withoutToken(body.Error.RequestParams)
+			if isRetryable(body.Error) {
+				return body.Error
+			}
+			return retry.Permanent(body.Error)
+		}
+		return nil
+	})
+	return body, err
+}
+
+// withoutToken removes the access token from the request params echoed back with an error,
+// so it doesn't end up in the logs along with the error.
+func withoutToken(params []RequestParam) []RequestParam {
+	filtered := params[:0]
+	for _, param := range params {
+		if param.Key != "access_token" {
+			filtered = append(filtered, param)
+		}
+	}
+	return filtered
+}
+
+// isRetryable reports whether the VK API error is temporary and the request may succeed if repeated.
+func isRetryable(err *VKError) bool {
+	return err.Code == ErrorCodeTooManyRequests || err.Code == ErrorCodeInternal
+}
@@ -0,0 +1,254 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goVkBot/internal/config"
+	"goVkBot/internal/models"
+	"goVkBot/internal/ratelimit"
+	"goVkBot/internal/retry"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// apiResponse is a scripted answer of the fake VK API.
+type apiResponse struct {
+	status int
+	body   string
+}
+
+// apiRequest holds what the fake VK API received in a request.
+type apiRequest struct {
+	path     string
+	rawQuery string
+	form     url.Values
+}
+
+// fakeAPI answers VK API requests with scripted responses, the last one is repeated once the script is exhausted.
+type fakeAPI struct {
+	mu        sync.Mutex
+	responses []apiResponse
+	requests  []apiRequest
+}
+
+// newFakeAPI starts a fake VK API and returns a bot calling it.
+// The retry policy has short delays, so retried requests don't slow the tests down.
+func newFakeAPI(t *testing.T, responses ...apiResponse) (*Bot, *fakeAPI) {
+	api := &fakeAPI{responses: responses}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("error reading the request: %v", err)
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			t.Errorf("error parsing the request body: %v", err)
+		}
+
+		api.mu.Lock()
+		api.requests = append(api.requests, apiRequest{path: r.URL.Path, rawQuery: r.URL.RawQuery, form: form})
+		response := api.responses[0]
+		if len(api.responses) > 1 {
+			api.responses = api.responses[1:]
+		}
+		api.mu.Unlock()
+
+		w.WriteHeader(response.status)
+		io.WriteString(w, response.body)
+	}))
+	t.Cleanup(srv.Close)
+
+	b := &Bot{
+		AccessToken: "secret-token",
+		Retry:       retry.Policy{InitialDelay: time.Millisecond, Multiplier: 1, MaxAttempts: 3},
+		Client:      config.Client{BaseURL: srv.URL + "/method", APIVersion: "5.131", Timeout: time.Second * 5},
+	}
+	return b, api
+}
+
+// calls returns the number of requests the fake VK API received.
+func (api *fakeAPI) calls() int {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return len(api.requests)
+}
+
+func TestCallDecodesResponse(t *testing.T) {
+	b, api := newFakeAPI(t, apiResponse{http.StatusOK, `{"response":[{"id":1,"name":"Бот"}]}`})
+
+	result := []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}{}
+	if err := b.Call(context.Background(), "groups.getById", url.Values{"group_id": {"1"}}, &result); err != nil {
+		t.Fatalf("Call returned %v", err)
+	}
+	if len(result) != 1 || result[0].ID != 1 || result[0].Name != "Бот" {
+		t.Errorf("got result %+v", result)
+	}
+
+	request := api.requests[0]
+	if request.path != "/method/groups.getById" {
+		t.Errorf("called %s, want /method/groups.getById", request.path)
+	}
+	if request.form.Get("group_id") != "1" || request.form.Get("v") != "5.131" || request.form.Get("access_token") != "secret-token" {
+		t.Errorf("sent params %v, want group_id, v and access_token", request.form)
+	}
+}
+
+func TestCallDecodesVKError(t *testing.T) {
+	b, _ := newFakeAPI(t, apiResponse{http.StatusOK, `{"error":{
+		"error_code":15,
+		"error_msg":"Access denied",
+		"request_params":[
+			{"key":"method","value":"messages.send"},
+			{"key":"access_token","value":"secret-token"},
+			{"key":"peer_id","value":"1"}
+		]
+	}}`})
+
+	err := b.Call(context.Background(), "messages.send", url.Values{"peer_id": {"1"}}, nil)
+
+	var vkErr *VKError
+	if !errors.As(err, &vkErr) {
+		t.Fatalf("Call returned %v, want a *VKError", err)
+	}
+	if vkErr.Code != ErrorCodeAccessDenied || vkErr.Message != "Access denied" {
+		t.Errorf("got error code %d and message %q, want %d and \"Access denied\"", vkErr.Code, vkErr.Message, ErrorCodeAccessDenied)
+	}
+	// the access token is stripped from the echoed params
+	wantParams := []RequestParam{{Key: "method", Value: "messages.send"}, {Key: "peer_id", Value: "1"}}
+	if !reflect.DeepEqual(vkErr.RequestParams, wantParams) {
+		t.Errorf("got request params %+v, want %+v", vkErr.RequestParams, wantParams)
+	}
+	if got := vkErr.Error(); got != "vk api error 15 in messages.send: Access denied" {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
+func TestIsErrorCode(t *testing.T) {
+	vkErr := &VKError{Code: ErrorCodeFlood, Message: "Flood control"}
+
+	tests := []struct {
+		name string
+		err  error
+		code int
+		want bool
+	}{
+		{"same code", vkErr, ErrorCodeFlood, true},
+		{"other code", vkErr, ErrorCodeAccessDenied, false},
+		{"wrapped", fmt.Errorf("error sending the message: %w", vkErr), ErrorCodeFlood, true},
+		{"wrapped twice", fmt.Errorf("handler: %w", fmt.Errorf("send: %w", vkErr)), ErrorCodeFlood, true},
+		{"not a VK error", errors.New("connection refused"), ErrorCodeFlood, false},
+		{"nil", nil, ErrorCodeFlood, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsErrorCode(test.err, test.code); got != test.want {
+				t.Errorf("IsErrorCode(%v, %d) = %v, want %v", test.err, test.code, got, test.want)
+			}
+		})
+	}
+}
+
+func TestWithoutToken(t *testing.T) {
+	params := []RequestParam{
+		{Key: "access_token", Value: "secret-token"},
+		{Key: "method", Value: "messages.send"},
+		{Key: "access_token", Value: "secret-token"},
+		{Key: "v", Value: "5.131"},
+	}
+	want := []RequestParam{{Key: "method", Value: "messages.send"}, {Key: "v", Value: "5.131"}}
+	if got := withoutToken(params); !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutToken = %+v, want %+v", got, want)
+	}
+	if got := withoutToken(nil); len(got) != 0 {
+		t.Errorf("withoutToken(nil) = %+v, want no params", got)
+	}
+}
+
+func TestCallRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []apiResponse
+		wantErr   bool
+		wantCalls int
+	}{
+		{"5xx is retried", []apiResponse{{http.StatusBadGateway, ``}, {http.StatusOK, `{"response":1}`}}, false, 2},
+		{"invalid JSON is retried", []apiResponse{{http.StatusOK, `<html>`}, {http.StatusOK, `{"response":1}`}}, false, 2},
+		{"too many requests is retried", []apiResponse{{http.StatusOK, `{"error":{"error_code":6,"error_msg":"Too many requests per second"}}`}, {http.StatusOK, `{"response":1}`}}, false, 2},
+		{"internal error is retried", []apiResponse{{http.StatusOK, `{"error":{"error_code":10,"error_msg":"Internal server error"}}`}, {http.StatusOK, `{"response":1}`}}, false, 2},
+		{"attempts are exhausted", []apiResponse{{http.StatusServiceUnavailable, ``}}, true, 3},
+		{"4xx is not retried", []apiResponse{{http.StatusNotFound, `not found`}, {http.StatusOK, `{"response":1}`}}, true, 1},
+		{"VK error is not retried", []apiResponse{{http.StatusOK, `{"error":{"error_code":100,"error_msg":"One of the parameters specified was missing or invalid"}}`}, {http.StatusOK, `{"response":1}`}}, true, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, api := newFakeAPI(t, test.responses...)
+			err := b.Call(context.Background(), "messages.markAsRead", url.Values{}, nil)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Call returned %v, want error: %v", err, test.wantErr)
+			}
+			if got := api.calls(); got != test.wantCalls {
+				t.Errorf("made %d requests, want %d", got, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCallWaitsForLimiter(t *testing.T) {
+	b, api := newFakeAPI(t,
+		apiResponse{http.StatusOK, `{"error":{"error_code":6,"error_msg":"Too many requests per second"}}`},
+		apiResponse{http.StatusOK, `{"response":1}`},
+	)
+	// one request is allowed at once and the next one 50ms later
+	b.Limiter = ratelimit.New(20, 1)
+
+	start := time.Now()
+	if err := b.Call(context.Background(), "messages.markAsRead", url.Values{}, nil); err != nil {
+		t.Fatalf("Call returned %v", err)
+	}
+	if got := api.calls(); got != 2 {
+		t.Errorf("made %d requests, want the one rejected with error 6 and the repeated one", got)
+	}
+	// the repeated request takes a token of the limiter too
+	if elapsed := time.Since(start); elapsed < time.Millisecond*45 {
+		t.Errorf("Call took %v, want the repeated request to wait for the limiter", elapsed)
+	}
+}
+
+func TestCallSendsParamsInBody(t *testing.T) {
+	b, api := newFakeAPI(t, apiResponse{http.StatusOK, `{"response":[{"peer_id":1,"message_id":10,"conversation_message_id":3}]}`})
+	// a long message that would hit URL length limits if it were sent in the query
+	message := "Привет! " + strings.Repeat("Погода в Москве & Лондоне? ", 400)
+
+	sent, err := b.SendMessageToServer(context.Background(), message, 1, models.Keyboard{})
+	if err != nil {
+		t.Fatalf("SendMessageToServer returned %v", err)
+	}
+	if len(sent) != 1 || sent[0].MessageID != 10 {
+		t.Errorf("got sent messages %+v, want the message 10", sent)
+	}
+
+	request := api.requests[0]
+	if request.rawQuery != "" {
+		t.Errorf("sent query %q, want all params in the body", request.rawQuery)
+	}
+	if request.form.Get("access_token") != "secret-token" {
+		t.Errorf("sent access_token %q in the body, want the token of the bot", request.form.Get("access_token"))
+	}
+	if request.form.Get("message") != message {
+		t.Errorf("the message in the body differs from the sent one")
+	}
+	if request.form.Get("peer_ids") != "1" {
+		t.Errorf("sent peer_ids %q, want 1", request.form.Get("peer_ids"))
+	}
+}
@@ -0,0 +1,202 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goVkBot/internal/models"
+	"net/url"
+	"strings"
+)
+
+// MaxBatchSize is the number of API calls VK allows in a single execute request.
+const MaxBatchSize = 25
+
+// ErrBatchFull is returned when a call is added to a batch that already holds MaxBatchSize calls.
+var ErrBatchFull = errors.New("batch already holds the maximum number of calls")
+
+// Batch collects VK API calls to submit them in one request through the execute method.
+// The first error returned while adding calls is remembered and returned by Execute,
+// so a handler can add its calls one after another and check the error once.
+// A Batch is not safe for concurrent use.
+type Batch struct {
+	bot   *Bot
+	calls []batchCall
+	err   error
+}
+
+// batchCall is a single API call added to a batch.
+type batchCall struct {
+	method string
+	params url.Values
+	result interface{}
+}
+
+// NewBatch creates an empty batch of calls made with the bot's access token.
+func (b *Bot) NewBatch() *Batch {
+	return &Batch{bot: b}
+}
+
+// Add adds an API call to the batch.
+//
+// Parameters:
+//   - method: The name of the VK API method, e.g. "messages.send".
+//   - params: The parameters of the method, the access token and API version are added by execute.
+//   - result: A pointer the result of the call is unmarshaled into, or nil if the result is not needed.
+//
+// Returns:
+//   - error: ErrBatchFull if the batch already holds MaxBatchSize calls.
+func (bt *Batch) Add(method string, params url.Values, result interface{}) error {
+	if len(bt.calls) >= MaxBatchSize {
+		return bt.fail(ErrBatchFull)
+	}
+	bt.calls = append(bt.calls, batchCall{method: method, params: params, result: result})
+	return nil
+}
+
+// Len returns the number of calls in the batch.
+func (bt *Batch) Len() int {
+	return len(bt.calls)
+}
+
+// SendMessageToServer adds a messages.send call to the batch, see Bot.SendMessageToServer.
+// The sent messages are unmarshaled into sent after Execute, unless it is nil.
+// Errors of single conversations are stored in the Error field of the sent messages.
+func (bt *Batch) SendMessageToServer(message string, peerID int, keyboard models.Keyboard, sent *[]models.SentMessage, opts ...SendOption) error {
+	message, keyboard = bt.bot.adaptKeyboard(message, peerID, keyboard)
+	params, err := sendMessageParams(message, peerID, keyboard, opts)
+	if err != nil {
+		return bt.fail(err)
+	}
+	if sent == nil {
+		return bt.Add("messages.send", params, nil)
+	}
+	return bt.Add("messages.send", params, sent)
+}
+
+// EditLastMessage adds a messages.edit call to the batch, see Bot.EditLastMessage.
+func (bt *Batch) EditLastMessage(message string, sent models.SentMessage, keyboard models.Keyboard) error {
+	message, keyboard = bt.bot.adaptKeyboard(message, sent.PeerID, keyboard)
+	params, err := editMessageParams(message, sent, keyboard)
+	if err != nil {
+		return bt.fail(err)
+	}
+	return bt.Add("messages.edit", params, nil)
+}
+
+// HandleButtonCallback adds a messages.sendMessageEventAnswer call to the batch, see Bot.HandleButtonCallback.
+func (bt *Batch) HandleButtonCallback(eventData models.EventAnswer, event models.MessageEvent) error {
+	params, err := eventAnswerParams(eventData, event)
+	if err != nil {
+		return bt.fail(err)
+	}
+	return bt.Add("messages.sendMessageEventAnswer", params, nil)
+}
+
+// Execute submits all calls of the batch in one execute request and empties the batch.
+//
+// Parameters:
+//   - ctx: The context the request is bound to.
+//
+// Returns:
+//   - []error: The error of every call in the order the calls were added, nil for the calls that succeeded.
+//     The results of the successful calls are unmarshaled into the pointers passed to Add.
+//   - error: An error if adding a call failed or the execute request itself failed, in which case none of the calls were made.
+//
+// Note:
+//   - The calls are turned into a VKScript program returning an array with the result of every call.
+//   - VK returns false in place of the result of a failed call and lists the errors in "execute_errors"
+//     in the order the calls failed, they are matched to the calls by that order.
+//   - An empty batch is not sent.
+func (bt *Batch) Execute(ctx context.Context) ([]error, error) {
+	calls, err := bt.calls, bt.err
+	bt.calls, bt.err = nil, nil
+	if err != nil {
+		return nil, err
+	}
+	if len(calls) == 0 {
+		return nil, nil
+	}
+
+	code, err := executeCode(calls)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	response, err := bt.bot.call(ctx, "execute", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []json.RawMessage
+	if err := json.Unmarshal(response.Response, &results); err != nil {
+		return nil, fmt.Errorf("error unmarshalling execute result: %w", err)
+	}
+	if len(results) != len(calls) {
+		return nil, fmt.Errorf("execute returned %d results for %d calls", len(results), len(calls))
+	}
+
+	errs := make([]error, len(calls))
+	executeErrors := response.ExecuteErrors
+	for i, call := range calls {
+		if string(results[i]) == "false" {
+			if len(executeErrors) > 0 {
+				errs[i], executeErrors = executeErrors[0], executeErrors[1:]
+			} else {
+				errs[i] = fmt.Errorf("%s failed in execute", call.method)
+			}
+			continue
+		}
+		if call.result == nil {
+			continue
+		}
+		if err := json.Unmarshal(results[i], call.result); err != nil {
+			errs[i] = fmt.Errorf("error unmarshalling %s result: %w", call.method, err)
+		}
+	}
+	return errs, nil
+}
+
+// fail remembers the first error for Execute and returns the error.
+func (bt *Batch) fail(err error) error {
+	if bt.err == nil {
+		bt.err = err
+	}
+	return err
+}
+
+// executeCode builds the VKScript program making the calls, e.g.
+// return [API.messages.send({"message":"hi"}),API.messages.sendMessageEventAnswer({...})];
+func executeCode(calls []batchCall) (string, error) {
+	code := strings.Builder{}
+	code.WriteString("return [")
+	for i, call := range calls {
+		if i > 0 {
+			code.WriteString(",")
+		}
+
+		args := map[string]string{}
+		for key := range call.params {
+			args[key] = call.params.Get(key)
+		}
+		// VKScript reads the arguments as an object literal, HTML escaping is not needed there
+		encoded := bytes.Buffer{}
+		encoder := json.NewEncoder(&encoded)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(args); err != nil {
+			return "", fmt.Errorf("error marshaling %s params: %w", call.method, err)
+		}
+
+		code.WriteString("API.")
+		code.WriteString(call.method)
+		code.WriteString("(")
+		code.WriteString(strings.TrimSpace(encoded.String()))
+		code.WriteString(")")
+	}
+	code.WriteString("];")
+	return code.String(), nil
+}
@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"goVkBot/internal/config"
+	"goVkBot/internal/models"
+	"goVkBot/internal/retry"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newTestBot creates a bot calling the API methods on a fake VK server answering every request with body.
+// The VKScript code of the execute requests is stored in code.
+func newTestBot(t *testing.T, body string, code *string) *Bot {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/method/execute" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("error parsing the request: %v", err)
+		}
+		if code != nil {
+			*code = r.PostForm.Get("code")
+		}
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	return &Bot{
+		AccessToken: "token",
+		Retry:       retry.Policy{InitialDelay: time.Millisecond, MaxAttempts: 1},
+		Client:      config.Client{BaseURL: srv.URL + "/method", APIVersion: "5.131", Timeout: time.Second * 5},
+	}
+}
+
+func TestExecuteCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls []batchCall
+		want  string
+	}{
+		{
+			name:  "single call",
+			calls: []batchCall{{method: "messages.send", params: url.Values{"peer_id": {"1"}, "message": {"hi"}}}},
+			want:  `return [API.messages.send({"message":"hi","peer_id":"1"})];`,
+		},
+		{
+			name: "multiple calls",
+			calls: []batchCall{
+				{method: "messages.send", params: url.Values{"message": {"hi"}}},
+				{method: "messages.sendMessageEventAnswer", params: url.Values{"event_id": {"e1"}}},
+			},
+			want: `return [API.messages.send({"message":"hi"}),API.messages.sendMessageEventAnswer({"event_id":"e1"})];`,
+		},
+		{
+			name:  "escaping",
+			calls: []batchCall{{method: "messages.send", params: url.Values{"message": {"\"quoted\" \\ <b>&</b>\nline"}}}},
+			want:  `return [API.messages.send({"message":"\"quoted\" \\ <b>&</b>\nline"})];`,
+		},
+		{
+			name:  "cyrillic",
+			calls: []batchCall{{method: "messages.send", params: url.Values{"message": {"Погода в Москве"}}}},
+			want:  `return [API.messages.send({"message":"Погода в Москве"})];`,
+		},
+		{
+			name:  "no params",
+			calls: []batchCall{{method: "groups.getById", params: url.Values{}}},
+			want:  `return [API.groups.getById({})];`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := executeCode(test.calls)
+			if err != nil {
+				t.Fatalf("executeCode returned an error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("executeCode = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBatchExecute(t *testing.T) {
+	var code string
+	b := newTestBot(t, `{
+		"response": [[{"peer_id":1,"message_id":10}], false, 1, false],
+		"execute_errors": [
+			{"method":"messages.edit","error_code":15,"error_msg":"Access denied"},
+			{"method":"messages.sendMessageEventAnswer","error_code":100,"error_msg":"One of the parameters specified was missing or invalid"}
+		]
+	}`, &code)
+
+	sent := []models.SentMessage{}
+	var answered int
+	batch := b.NewBatch()
+	batch.Add("messages.send", url.Values{"peer_id": {"1"}}, &sent)
+	batch.Add("messages.edit", url.Values{"peer_id": {"1"}}, nil)
+	batch.Add("messages.markAsRead", url.Values{"peer_id": {"1"}}, &answered)
+	batch.Add("messages.sendMessageEventAnswer", url.Values{"event_id": {"e1"}}, nil)
+
+	errs, err := batch.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute returned an error: %v", err)
+	}
+
+	wantCode := `return [API.messages.send({"peer_id":"1"}),API.messages.edit({"peer_id":"1"}),` +
+		`API.messages.markAsRead({"peer_id":"1"}),API.messages.sendMessageEventAnswer({"event_id":"e1"})];`
+	if code != wantCode {
+		t.Errorf("sent code %s, want %s", code, wantCode)
+	}
+	if len(errs) != 4 {
+		t.Fatalf("got %d errors, want one per call: %v", len(errs), errs)
+	}
+	if errs[0] != nil || errs[2] != nil {
+		t.Errorf("got errors %v for the successful calls", errs)
+	}
+	wantCodes := map[int]int{1: 15, 3: 100}
+	for i, wantCode := range wantCodes {
+		var vkErr *VKError
+		if !errors.As(errs[i], &vkErr) || vkErr.Code != wantCode {
+			t.Errorf("call %d: got error %v, want error code %d", i, errs[i], wantCode)
+		}
+	}
+	if len(sent) != 1 || sent[0].PeerID != 1 || sent[0].MessageID != 10 {
+		t.Errorf("got sent messages %+v, want the message 10 in peer 1", sent)
+	}
+	if answered != 1 {
+		t.Errorf("got result %d of messages.markAsRead, want 1", answered)
+	}
+	if batch.Len() != 0 {
+		t.Errorf("batch holds %d calls after Execute, want 0", batch.Len())
+	}
+}
+
+func TestBatchExecuteResultCountMismatch(t *testing.T) {
+	b := newTestBot(t, `{"response": [1]}`, nil)
+
+	batch := b.NewBatch()
+	batch.Add("messages.markAsRead", url.Values{"peer_id": {"1"}}, nil)
+	batch.Add("messages.markAsRead", url.Values{"peer_id": {"2"}}, nil)
+
+	_, err := batch.Execute(context.Background())
+	if err == nil || err.Error() != "execute returned 1 results for 2 calls" {
+		t.Errorf("Execute returned %v, want the result count mismatch error", err)
+	}
+}
+
+func TestBatchExecuteFull(t *testing.T) {
+	b := newTestBot(t, `{"response": []}`, nil)
+
+	batch := b.NewBatch()
+	for i := 0; i < MaxBatchSize; i++ {
+		if err := batch.Add("messages.markAsRead", url.Values{}, nil); err != nil {
+			t.Fatalf("Add %d returned an error: %v", i+1, err)
+		}
+	}
+	if err := batch.Add("messages.markAsRead", url.Values{}, nil); !errors.Is(err, ErrBatchFull) {
+		t.Errorf("Add returned %v, want %v", err, ErrBatchFull)
+	}
+	if _, err := batch.Execute(context.Background()); !errors.Is(err, ErrBatchFull) {
+		t.Errorf("Execute returned %v, want %v", err, ErrBatchFull)
+	}
+}
@@ -1,13 +1,15 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"goVkBot/internal/config"
 	"goVkBot/internal/models"
+	"goVkBot/internal/ratelimit"
+	"goVkBot/internal/retry"
 	"goVkBot/internal/utils"
-	"io"
-	"log"
-	"net/http"
 	"net/url"
 	"strconv"
 )
@@ -16,156 +18,196 @@ type Bot struct {
 	AccessToken   string
 	GroupId       string
 	ServerUrl     string
+	Key           string
 	LastTimeStamp string
+	// Retry is the policy used for failed requests to VK
+	Retry retry.Policy
+	// Client configures the VK API address, version and HTTP client, see config.Default
+	Client config.Client
+	// Limiter keeps the requests within the VK limits for the access token, requests are not limited if nil
+	Limiter *ratelimit.Limiter
+	// Clients keeps the features supported by the clients of the users, keyboards are sent as is if nil
+	Clients *ClientRegistry
 }
 
 // GetLongPollServer retrieves the long poll server information for a VK group.
-// It makes a GET request to the VK API to obtain the server URL, key, and timestamp.
-// The function takes a VK access token and group ID as parameters.
-// It returns the constructed long poll URL and the timestamp for subsequent requests.
-// In case of an error, the error is logged and an empty string is returned for the URL and timestamp.
-func (b *Bot) GetLongPollServer() {
-	// Construct the API URL
-	serverUrl := fmt.Sprintf("https://api.vk.com/method/groups.getLongPollServer?access_token=%s&v=5.131&group_id=%s", b.AccessToken, b.GroupId)
+// It calls the groups.getLongPollServer method to obtain the server URL, key, and timestamp.
+// The VK access token and group ID are taken from the bot.
+// The request is bound to the provided context and retried according to the bot's retry policy,
+// errors returned by the VK API itself are not retried.
+// On success the server URL, key and timestamp are stored in the bot for subsequent requests.
+// In case of an error the bot is left untouched and the error is returned, so the caller can retry.
+func (b *Bot) GetLongPollServer(ctx context.Context) error {
+	params := url.Values{}
+	params.Set("group_id", b.GroupId)
 
-	// Send a GET request to the VK API
-	resp, err := http.Get(serverUrl)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	// Parse the response JSON
 	var longPollServerCredentials struct {
-		Response struct {
-			Key    string `json:"key"`
-			Server string `json:"server"`
-			Ts     string `json:"ts"`
-		} `json:"response"`
+		Key    string `json:"key"`
+		Server string `json:"server"`
+		Ts     string `json:"ts"`
 	}
-	err = json.Unmarshal(body, &longPollServerCredentials)
-	if err != nil {
-		log.Println(err)
-		return
+	if err := b.Call(ctx, "groups.getLongPollServer", params, &longPollServerCredentials); err != nil {
+		return err
+	}
+	if longPollServerCredentials.Server == "" || longPollServerCredentials.Key == "" {
+		return errors.New("long poll server response is missing server or key")
 	}
 
-	// Construct the long poll URL
-	longPollURL := fmt.Sprintf("%s?act=a_check&key=%s&ts=%s&wait=25", longPollServerCredentials.Response.Server, longPollServerCredentials.Response.Key, `%s`)
-
-	b.ServerUrl = longPollURL
-	b.LastTimeStamp = longPollServerCredentials.Response.Ts
+	b.ServerUrl = longPollServerCredentials.Server
+	b.Key = longPollServerCredentials.Key
+	b.LastTimeStamp = longPollServerCredentials.Ts
+	return nil
 }
 
 // SendMessageToServer sends a message and an optional keyboard to the server using the VK API.
 //
 // Parameters:
+//   - ctx: The context the request is bound to.
 //   - message: A string representing the message to be sent.
-//   - response: A struct containing the server response data.
+//   - peerID: The ID of the conversation the message is sent to: a user, a group chat (2000000000+) or a community.
 //   - keyboard: A struct representing the keyboard to be sent along with the message (optional).
+//   - opts: Additional options of the message, such as WithAttachment or ToPeers.
+//
+// Returns:
+//   - []models.SentMessage: The sent message in every conversation it was sent to, with its message ID
+//     and conversation message ID, which can be passed to EditLastMessage.
+//   - error: A *VKError if VK rejected the message, e.g. with ErrorCodeCantSendToUser, or a request error.
+//     If the message was sent to several conversations, the errors of every conversation VK rejected the message in
+//     are joined, and the sent messages are returned along with them.
 //
 // Note:
-//   - The method prepares the necessary parameters and constructs the API URL to send the message
-//     and keyboard (if provided) to the VK server.
-//   - The method performs URL encoding for the message and keyboard parameters.
-//   - If a keyboard is provided, it is marshaled to JSON format before being URL encoded.
-//   - The user ID is extracted from the server response to determine the recipient of the message.
+//   - If a keyboard with buttons is provided, it is marshaled to JSON format before being sent.
+//     An empty keyboard leaves the keyboard of the conversation as is, use RemoveKeyboard to hide it.
+//   - Replying to the peer_id of an incoming message sends the reply to the conversation the message came from,
+//     so the bot answers in group chats instead of the sender's private messages.
+//   - The message is always sent with the peer_ids parameter, so VK returns the IDs of the sent messages.
+//   - The keyboard is adapted to the client of the conversation if the bot has Clients, see ClientRegistry.
 //   - A random ID is generated for each message sent.
-//   - The VK API URL is constructed with the appropriate parameters, including access token, user ID,
-//     random ID, message, and keyboard.
-//   - If no keyboard is provided (empty string), the API URL is constructed without the keyboard parameter.
-//   - The MakePostRequestWithUrl function is used to send the POST request to the VK API endpoint.
-//   - Error handling is performed for parameter marshaling, URL encoding, and the POST request.
-//     If an error occurs, an appropriate error message is logged.
-func (b *Bot) SendMessageToServer(message string, response models.ServerResponse, keyboard models.Keyboard) {
-	payload, err := json.Marshal(keyboard)
+//   - The messages.send method is called with Call.
+func (b *Bot) SendMessageToServer(ctx context.Context, message string, peerID int, keyboard models.Keyboard, opts ...SendOption) ([]models.SentMessage, error) {
+	message, keyboard = b.adaptKeyboard(message, peerID, keyboard)
+	params, err := sendMessageParams(message, peerID, keyboard, opts)
 	if err != nil {
-		log.Println("error marshaling the keyboard:", err)
-		return
+		return nil, err
+	}
+
+	results := []models.SentMessage{}
+	if err := b.Call(ctx, "messages.send", params, &results); err != nil {
+		return nil, err
+	}
+
+	sent := make([]models.SentMessage, 0, len(results))
+	errs := []error{}
+	for _, result := range results {
+		if result.Error != nil {
+			errs = append(errs, &VKError{Code: result.Error.Code, Message: result.Error.Description, Method: "messages.send"})
+			continue
+		}
+		sent = append(sent, result)
 	}
+	return sent, errors.Join(errs...)
+}
 
-	userId := strconv.Itoa(response.Updates[0].Object.Message.FromID)
-	if userId == "0" {
-		userId = strconv.Itoa(response.Updates[0].Object.PeerID)
+// sendMessageParams prepares the parameters of messages.send for SendMessageToServer.
+func sendMessageParams(message string, peerID int, keyboard models.Keyboard, opts []SendOption) (url.Values, error) {
+	params := url.Values{}
+	params.Set("peer_ids", strconv.Itoa(peerID))
+	params.Set("random_id", utils.GetRandomInt32())
+	params.Set("message", message)
+	if err := setKeyboard(params, keyboard); err != nil {
+		return nil, err
 	}
-	randomId := utils.GetRandomInt32()
-	encodedMessage := url.QueryEscape(message)
-	encodedKeyboard := url.QueryEscape(string(payload))
-	serverUrl := fmt.Sprintf("https://api.vk.com/method/messages.send?user_id=%s&random_id=%s&keyboard=%s&message=%s&access_token=%s&v=5.131", userId, randomId, encodedKeyboard, encodedMessage, b.AccessToken)
-	//if there is no keyboard
-	if encodedKeyboard == "" {
-		serverUrl = fmt.Sprintf("https://api.vk.com/method/messages.send?user_id=%s&random_id=%s&message=%s&access_token=%s&v=5.131", userId, randomId, encodedMessage, b.AccessToken)
+	for _, opt := range opts {
+		opt(params)
 	}
-	utils.MakePostRequestWithUrl(serverUrl)
+	return params, nil
 }
 
-// EditLastMessage edits the last sent message with the provided message content, keyboard, and conversation message ID.
+// EditLastMessage edits a message sent by the bot with the provided message content and keyboard.
 //
 // Parameters:
+//   - ctx: The context the request is bound to.
 //   - message: A string representing the updated message content.
-//   - response: A struct containing the server response data.
-//   - cmId: A string representing the conversation message ID of the message to be edited.
+//   - sent: The message to be edited as returned by SendMessageToServer, e.g. taken from a MessageRegistry.
 //   - keyboard: A struct representing the updated keyboard (optional).
 //
+// Returns:
+//   - error: A *VKError if VK rejected the edit, or a request error.
+//
 // Note:
-//   - The method prepares the necessary parameters and constructs the API URL to edit the last sent message.
-//   - The method performs URL encoding for the message and keyboard parameters.
-//   - If a keyboard is provided, it is marshaled to JSON format before being URL encoded.
-//   - The peer ID is extracted from the server response to identify the conversation.
-//   - The VK API URL is constructed with the appropriate parameters, including peer ID,
-//     message content, conversation message ID, keyboard, and access token.
-//   - If no keyboard is provided (empty string), the API URL is constructed without the keyboard parameter.
-//   - The MakePostRequestWithUrl function is used to send the POST request to the VK API endpoint.
-//   - Error handling is performed for parameter marshaling, URL encoding, and the POST request.
-//     If an error occurs, an appropriate error message is logged.
-func (b *Bot) EditLastMessage(message string, response models.ServerResponse, cmId string, keyboard models.Keyboard) {
-	payload, err := json.Marshal(keyboard)
+//   - If a keyboard with buttons is provided, it is marshaled to JSON format before being sent.
+//   - The keyboard is adapted to the client of the conversation like in SendMessageToServer.
+//   - The message is identified by its peer ID and conversation message ID.
+//   - The messages.edit method is called with Call.
+func (b *Bot) EditLastMessage(ctx context.Context, message string, sent models.SentMessage, keyboard models.Keyboard) error {
+	message, keyboard = b.adaptKeyboard(message, sent.PeerID, keyboard)
+	params, err := editMessageParams(message, sent, keyboard)
 	if err != nil {
-		log.Println("error marshaling the keyboard:", err)
-		return
+		return err
+	}
+	return b.Call(ctx, "messages.edit", params, nil)
+}
+
+// editMessageParams prepares the parameters of messages.edit for EditLastMessage.
+func editMessageParams(message string, sent models.SentMessage, keyboard models.Keyboard) (url.Values, error) {
+	params := url.Values{}
+	params.Set("peer_id", strconv.Itoa(sent.PeerID))
+	params.Set("message", message)
+	params.Set("conversation_message_id", strconv.Itoa(sent.ConversationMessageID))
+	if err := setKeyboard(params, keyboard); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// setKeyboard adds the keyboard to the parameters of a message.
+// A keyboard without buttons is left out, so the message doesn't change the keyboard the user already has,
+// use RemoveKeyboard to hide it.
+func setKeyboard(params url.Values, keyboard models.Keyboard) error {
+	if len(keyboard.Buttons) == 0 {
+		return nil
 	}
-	encodedMessage := url.QueryEscape(message)
-	encodedKeyboard := url.QueryEscape(string(payload))
-	peerId := strconv.Itoa(response.Updates[0].Object.PeerID)
-	serverUrl := fmt.Sprintf("https://api.vk.com/method/messages.edit?peer_id=%s&message=%s&conversation_message_id=%s&keyboard=%s&access_token=%s&v=5.131", peerId, encodedMessage, cmId, encodedKeyboard, b.AccessToken)
-	//if there is no keyboard
-	if encodedKeyboard == "" {
-		serverUrl = fmt.Sprintf("https://api.vk.com/method/messages.edit?peer_id=%s&message=%s&conversation_message_id=%s&access_token=%s&v=5.131", peerId, encodedMessage, cmId, b.AccessToken)
+	payload, err := json.Marshal(keyboard)
+	if err != nil {
+		return fmt.Errorf("error marshaling the keyboard: %w", err)
 	}
-	utils.MakePostRequestWithUrl(serverUrl)
+	params.Set("keyboard", string(payload))
+	return nil
 }
 
 // HandleButtonCallback handles the callback event triggered by a button click.
 //
 // Parameters:
+//   - ctx: The context the request is bound to.
 //   - eventData: A struct containing the event answer data received from the button callback.
-//   - response: A struct containing the server response data.
+//   - event: The object of the "message_event" update sent when the button was pressed.
+//
+// Returns:
+//   - error: A *VKError if VK rejected the answer, or a request error.
 //
 // Note:
-//   - The method prepares the necessary parameters and constructs the API URL to handle the button callback.
-//   - The eventData parameter is marshaled to JSON format and URL encoded.
-//   - The event ID and peer ID are extracted from the server response.
-//   - The VK API URL is constructed with the appropriate parameters, including event ID, user ID (peer ID),
-//     encoded event data, and access token.
-//   - The MakePostRequestWithUrl function is used to send the POST request to the VK API endpoint.
-//   - Error handling is performed for parameter marshaling and the POST request.
-//     If an error occurs, an appropriate error message is logged.
-func (b *Bot) HandleButtonCallback(eventData models.EventAnswer, response models.ServerResponse) {
+//   - The eventData parameter is marshaled to JSON format.
+//   - The event ID, user ID and peer ID are taken from the event.
+//   - The messages.sendMessageEventAnswer method is called with Call.
+func (b *Bot) HandleButtonCallback(ctx context.Context, eventData models.EventAnswer, event models.MessageEvent) error {
+	params, err := eventAnswerParams(eventData, event)
+	if err != nil {
+		return err
+	}
+	return b.Call(ctx, "messages.sendMessageEventAnswer", params, nil)
+}
+
+// eventAnswerParams prepares the parameters of messages.sendMessageEventAnswer for HandleButtonCallback.
+func eventAnswerParams(eventData models.EventAnswer, event models.MessageEvent) (url.Values, error) {
 	payload, err := json.Marshal(eventData)
 	if err != nil {
-		log.Println("error marshaling the keyboard:", err)
-		return
+		return nil, fmt.Errorf("error marshaling the event data: %w", err)
 	}
-	encodedEventData := url.QueryEscape(string(payload))
-	eventId := response.Updates[0].Object.EventID
-	peerID := strconv.Itoa(response.Updates[0].Object.PeerID)
-	serverUrl := fmt.Sprintf("https://api.vk.com/method/messages.sendMessageEventAnswer?event_id=%s&user_id=%s&peer_id=%s&event_data=%s&access_token=%s&v=5.131", eventId, peerID, peerID, encodedEventData, b.AccessToken)
-	utils.MakePostRequestWithUrl(serverUrl)
+
+	params := url.Values{}
+	params.Set("event_id", event.EventID)
+	params.Set("user_id", strconv.Itoa(event.UserID))
+	params.Set("peer_id", strconv.Itoa(event.PeerID))
+	params.Set("event_data", string(payload))
+	return params, nil
 }
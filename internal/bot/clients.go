@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"goVkBot/internal/cache"
+	"goVkBot/internal/keyboard"
+	"goVkBot/internal/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientRegistry keeps the features supported by the client of the user in every conversation,
+// so the bot can send keyboards the client is able to show.
+// The client info comes with every message_new update, in group chats the client of the last sender is kept.
+// It keeps at most capacity conversations and forgets a conversation after ttl without messages,
+// so memory stays bounded no matter how many users write to the bot.
+// A ClientRegistry is safe for concurrent use, a nil registry remembers nothing.
+type ClientRegistry struct {
+	mu    sync.Mutex
+	peers *cache.Cache[int, *peerClient]
+}
+
+// peerClient is the client info of a conversation together with the last text menu sent to it.
+type peerClient struct {
+	client models.ClientInfo
+	// menu holds the numbered buttons of the last text menu, see keyboard.TextMenu
+	menu []models.Button
+}
+
+// NewClientRegistry creates an empty registry.
+//
+// Parameters:
+//   - capacity: The maximum number of remembered conversations, the ones without messages for the longest time
+//     are forgotten first. Values below 1 are treated as 1.
+//   - ttl: How long a conversation is remembered after its last message.
+func NewClientRegistry(capacity int, ttl time.Duration) *ClientRegistry {
+	return &ClientRegistry{peers: cache.New[int, *peerClient](capacity, ttl)}
+}
+
+// Remember stores the client info received with a message in the conversation.
+func (r *ClientRegistry) Remember(peerID int, client models.ClientInfo) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// the text menu sent before is kept, the message may be the user's choice from it
+	peer, ok := r.peers.Get(peerID)
+	if !ok {
+		peer = &peerClient{}
+	}
+	peer.client = client
+	r.peers.Set(peerID, peer)
+}
+
+// Client returns the client info of the conversation, if a message was received from it.
+func (r *ClientRegistry) Client(peerID int) (models.ClientInfo, bool) {
+	if r == nil {
+		return models.ClientInfo{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	peer, ok := r.peers.Get(peerID)
+	if !ok {
+		return models.ClientInfo{}, false
+	}
+	return peer.client, true
+}
+
+// Choice returns the button the user chose by replying with its number to the last text menu sent to the conversation,
+// see keyboard.TextMenu. It returns false if the text isn't the number of a button of the menu.
+// The menu is forgotten once a button is chosen, so later messages with numbers are read as text again.
+func (r *ClientRegistry) Choice(peerID int, text string) (models.Button, bool) {
+	if r == nil {
+		return models.Button{}, false
+	}
+	number, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil {
+		return models.Button{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	peer, ok := r.peers.Get(peerID)
+	if !ok || number < 1 || number > len(peer.menu) {
+		return models.Button{}, false
+	}
+	button := peer.menu[number-1]
+	peer.menu = nil
+	return button, true
+}
+
+// rememberMenu stores the numbered buttons of the text menu sent to the conversation,
+// nil forgets the menu, e.g. when a keyboard replaces it.
+func (r *ClientRegistry) rememberMenu(peerID int, choices []models.Button) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if peer, ok := r.peers.Get(peerID); ok {
+		peer.menu = choices
+	}
+}
+
+// adaptKeyboard changes the keyboard of a message to one the client of the conversation can show, see keyboard.Adapt.
+// If the client can't show keyboards at all, the buttons are added to the message as a numbered text menu.
+// Messages to conversations the bot has no client info for are left as is.
+func (b *Bot) adaptKeyboard(message string, peerID int, kb models.Keyboard) (string, models.Keyboard) {
+	client, ok := b.Clients.Client(peerID)
+	if !ok || len(kb.Buttons) == 0 {
+		return message, kb
+	}
+	adapted := keyboard.Adapt(kb, client)
+	if len(adapted.Buttons) > 0 {
+		// the keyboard replaces the text menu sent before
+		b.Clients.rememberMenu(peerID, nil)
+		return message, adapted
+	}
+
+	menu, choices := keyboard.TextMenu(kb)
+	b.Clients.rememberMenu(peerID, choices)
+	if menu == "" {
+		return message, adapted
+	}
+	if message == "" {
+		return menu, adapted
+	}
+	return message + "\n\n" + menu, adapted
+}
@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"goVkBot/internal/keyboard"
+	"goVkBot/internal/models"
+	"testing"
+	"time"
+)
+
+func TestAdaptKeyboardTextMenu(t *testing.T) {
+	b := &Bot{Clients: NewClientRegistry(10, time.Minute)}
+	b.Clients.Remember(1, models.ClientInfo{})
+	b.Clients.Remember(2, models.ClientInfo{Keyboard: true})
+	menu := models.Keyboard{Buttons: [][]models.Button{
+		{keyboard.Text("Погода", "", `{"cmd":"weather"}`)},
+		{keyboard.Callback("Котик", "", `{"cmd":"cat"}`)},
+	}}
+
+	// a client without keyboards gets the buttons as text
+	message, adapted := b.adaptKeyboard("Выбери:", 1, menu)
+	if message != "Выбери:\n\n1. Погода\n2. Котик" || len(adapted.Buttons) != 0 {
+		t.Errorf("got message %q with keyboard %+v, want the text menu without a keyboard", message, adapted)
+	}
+	if button, ok := b.Clients.Choice(1, " 2 "); !ok || button.Action.Label != "Котик" {
+		t.Errorf("Choice(2) = %+v, %v, want the second button", button, ok)
+	}
+	// the menu is used up by the choice
+	if _, ok := b.Clients.Choice(1, "1"); ok {
+		t.Errorf("Choice returned a button of a menu that was already used")
+	}
+
+	// a client with keyboards gets the keyboard and the text menu sent before is forgotten
+	b.Clients.rememberMenu(2, []models.Button{menu.Buttons[0][0]})
+	message, adapted = b.adaptKeyboard("Выбери:", 2, menu)
+	if message != "Выбери:" || len(adapted.Buttons) != 2 {
+		t.Errorf("got message %q with keyboard %+v, want the keyboard as is", message, adapted)
+	}
+	if _, ok := b.Clients.Choice(2, "1"); ok {
+		t.Errorf("Choice returned a button of a menu replaced by a keyboard")
+	}
+
+	// conversations the bot has no client info for are left as is
+	message, adapted = b.adaptKeyboard("Выбери:", 3, menu)
+	if message != "Выбери:" || len(adapted.Buttons) != 2 {
+		t.Errorf("got message %q with keyboard %+v for an unknown client, want them as is", message, adapted)
+	}
+}
+
+func TestClientRegistryBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		ttl      time.Duration
+		// wait is the pause before the last peer is remembered
+		wait time.Duration
+		// want tells which of the peers 1, 2 and 3 are still known at the end
+		want map[int]bool
+	}{
+		{"capacity evicts the oldest", 2, time.Minute, 0, map[int]bool{1: false, 2: true, 3: true}},
+		{"ttl forgets inactive peers", 10, time.Millisecond * 30, time.Millisecond * 50, map[int]bool{1: false, 2: false, 3: true}},
+		{"capacity below 1", 0, time.Minute, 0, map[int]bool{1: false, 2: false, 3: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := NewClientRegistry(test.capacity, test.ttl)
+			registry.Remember(1, models.ClientInfo{})
+			registry.Remember(2, models.ClientInfo{})
+			time.Sleep(test.wait)
+			registry.Remember(3, models.ClientInfo{})
+
+			for peerID, want := range test.want {
+				if _, ok := registry.Client(peerID); ok != want {
+					t.Errorf("Client(%d) known: %v, want %v", peerID, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestClientRegistryRefreshesActivePeers(t *testing.T) {
+	registry := NewClientRegistry(2, time.Minute)
+	registry.Remember(1, models.ClientInfo{})
+	registry.Remember(2, models.ClientInfo{})
+	// a new message moves peer 1 to the back, so peer 2 is evicted instead
+	registry.Remember(1, models.ClientInfo{Keyboard: true})
+	registry.Remember(3, models.ClientInfo{})
+
+	if client, ok := registry.Client(1); !ok || !client.Keyboard {
+		t.Errorf("Client(1) = %+v, %v, want the updated client info", client, ok)
+	}
+	if _, ok := registry.Client(2); ok {
+		t.Errorf("Client(2) is still known, want it evicted")
+	}
+}
+
+func TestNilClientRegistry(t *testing.T) {
+	var registry *ClientRegistry
+	registry.Remember(1, models.ClientInfo{Keyboard: true})
+	registry.rememberMenu(1, []models.Button{{}})
+	if _, ok := registry.Client(1); ok {
+		t.Errorf("nil registry returned a client")
+	}
+	if _, ok := registry.Choice(1, "1"); ok {
+		t.Errorf("nil registry returned a choice")
+	}
+}
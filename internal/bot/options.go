@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"encoding/json"
+	"goVkBot/internal/models"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SendOption sets additional parameters of a message sent with SendMessageToServer.
+type SendOption func(params url.Values)
+
+// WithAttachment attaches media to the message.
+// The attachments are strings in the <type><owner_id>_<media_id>[_<access_key>] format, e.g. as returned by UploadPhoto.
+// The option can be used several times, all attachments are sent together.
+func WithAttachment(attachments ...string) SendOption {
+	return func(params url.Values) {
+		all := attachments
+		if existing := params.Get("attachment"); existing != "" {
+			all = append(strings.Split(existing, ","), attachments...)
+		}
+		params.Set("attachment", strings.Join(all, ","))
+	}
+}
+
+// ToPeers sends the message to several conversations at once instead of the one passed to SendMessageToServer.
+// VK accepts up to 100 peer IDs.
+func ToPeers(peerIDs ...int) SendOption {
+	return func(params url.Values) {
+		params.Del("user_ids")
+		params.Set("peer_ids", joinIDs(peerIDs))
+	}
+}
+
+// ToUsers sends the message to the private messages of several users instead of the conversation
+// passed to SendMessageToServer. VK accepts up to 100 user IDs.
+func ToUsers(userIDs ...int) SendOption {
+	return func(params url.Values) {
+		params.Del("peer_ids")
+		params.Set("user_ids", joinIDs(userIDs))
+	}
+}
+
+// joinIDs formats IDs as a comma separated list.
+func joinIDs(ids []int) string {
+	formatted := make([]string, len(ids))
+	for i, id := range ids {
+		formatted[i] = strconv.Itoa(id)
+	}
+	return strings.Join(formatted, ",")
+}
+
+// ReplyTo quotes the message with the given ID in the reply.
+// Message IDs are only known in private messages, use ReplyToMessage to reply in group chats.
+func ReplyTo(messageID int) SendOption {
+	return func(params url.Values) {
+		params.Set("reply_to", strconv.Itoa(messageID))
+	}
+}
+
+// Forward forwards messages of a conversation along with the message,
+// or quotes them if forward.IsReply is set.
+func Forward(forward models.Forward) SendOption {
+	return func(params url.Values) {
+		// the struct has only numbers and slices of numbers, marshaling it can't fail
+		encoded, _ := json.Marshal(forward)
+		params.Set("forward", string(encoded))
+	}
+}
+
+// ReplyToMessage quotes the received message in the reply.
+// It refers to the message by its conversation message ID, so it works both in private messages and group chats.
+func ReplyToMessage(message models.Message) SendOption {
+	return Forward(models.Forward{
+		PeerID:                 message.PeerID,
+		ConversationMessageIDs: []int{message.ConversationMessageID},
+		IsReply:                true,
+	})
+}
+
+// RemoveKeyboard hides the keyboard the user has in the conversation, replacing the keyboard passed to SendMessageToServer.
+// VK removes the keyboard when it receives one without buttons.
+func RemoveKeyboard() SendOption {
+	return func(params url.Values) {
+		// the keyboard has no buttons to fail on, marshaling it can't fail
+		encoded, _ := json.Marshal(models.Keyboard{OneTime: true, Buttons: [][]models.Button{}})
+		params.Set("keyboard", string(encoded))
+	}
+}
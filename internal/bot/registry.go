@@ -0,0 +1,48 @@
+package bot
+
+import (
+	"goVkBot/internal/cache"
+	"goVkBot/internal/models"
+	"sync"
+	"time"
+)
+
+// MessageRegistry keeps track of the messages sent by the bot, so they can be edited later.
+// Messages are grouped by kind, e.g. "weather", and only the last message of every kind is kept per conversation.
+// It keeps at most capacity messages and forgets a message after ttl, so memory stays bounded
+// no matter how many conversations the bot sends messages to.
+// A MessageRegistry is safe for concurrent use.
+type MessageRegistry struct {
+	mu       sync.Mutex
+	messages *cache.Cache[registryKey, models.SentMessage]
+}
+
+// registryKey identifies the last message of a kind in a conversation.
+type registryKey struct {
+	peerID int
+	kind   string
+}
+
+// NewMessageRegistry creates an empty registry.
+//
+// Parameters:
+//   - capacity: The maximum number of remembered messages, the ones sent the longest time ago are forgotten first.
+//     Values below 1 are treated as 1.
+//   - ttl: How long a message is remembered after it was sent.
+func NewMessageRegistry(capacity int, ttl time.Duration) *MessageRegistry {
+	return &MessageRegistry{messages: cache.New[registryKey, models.SentMessage](capacity, ttl)}
+}
+
+// Remember stores the sent message as the last message of the kind in its conversation.
+func (r *MessageRegistry) Remember(kind string, message models.SentMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages.Set(registryKey{peerID: message.PeerID, kind: kind}, message)
+}
+
+// Last returns the last message of the kind sent to the conversation, if there is one.
+func (r *MessageRegistry) Last(peerID int, kind string) (models.SentMessage, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.messages.Get(registryKey{peerID: peerID, kind: kind})
+}
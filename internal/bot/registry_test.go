@@ -0,0 +1,40 @@
+package bot
+
+import (
+	"goVkBot/internal/models"
+	"testing"
+	"time"
+)
+
+func TestMessageRegistry(t *testing.T) {
+	registry := NewMessageRegistry(2, time.Minute)
+	registry.Remember("weather", models.SentMessage{PeerID: 1, ConversationMessageID: 10})
+	registry.Remember("weather", models.SentMessage{PeerID: 1, ConversationMessageID: 11})
+	registry.Remember("booking", models.SentMessage{PeerID: 1, ConversationMessageID: 12})
+
+	// only the last message of every kind is kept per conversation
+	if sent, ok := registry.Last(1, "weather"); !ok || sent.ConversationMessageID != 11 {
+		t.Errorf("Last(1, weather) = %+v, %v, want the message 11", sent, ok)
+	}
+	if _, ok := registry.Last(2, "weather"); ok {
+		t.Errorf("Last(2, weather) returned a message of another conversation")
+	}
+
+	// the capacity forgets the message sent the longest time ago
+	registry.Remember("weather", models.SentMessage{PeerID: 2, ConversationMessageID: 1})
+	if _, ok := registry.Last(1, "weather"); ok {
+		t.Errorf("Last(1, weather) returned a message over the capacity")
+	}
+	if sent, ok := registry.Last(1, "booking"); !ok || sent.ConversationMessageID != 12 {
+		t.Errorf("Last(1, booking) = %+v, %v, want the message 12", sent, ok)
+	}
+}
+
+func TestMessageRegistryTTL(t *testing.T) {
+	registry := NewMessageRegistry(10, time.Millisecond*30)
+	registry.Remember("weather", models.SentMessage{PeerID: 1, ConversationMessageID: 10})
+	time.Sleep(time.Millisecond * 50)
+	if _, ok := registry.Last(1, "weather"); ok {
+		t.Errorf("Last returned a message remembered longer than ttl ago")
+	}
+}
@@ -0,0 +1,295 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goVkBot/internal/models"
+	"goVkBot/internal/retry"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+// UploadPhoto uploads an image so it can be attached to a message in the given conversation.
+//
+// Parameters:
+//   - ctx: The context the requests are bound to.
+//   - peerID: The ID of the conversation the photo will be sent to.
+//   - filename: The name of the file, VK uses its extension to detect the image format.
+//   - data: The content of the image.
+//
+// Returns:
+//   - string: The attachment string to pass to WithAttachment, e.g. "photo-123_456_abc".
+//   - error: An error if any of the steps failed.
+//
+// Note:
+//   - The upload takes three steps: photos.getMessagesUploadServer returns the upload address,
+//     the image is posted there as multipart form data, and photos.saveMessagesPhoto saves the uploaded image.
+func (b *Bot) UploadPhoto(ctx context.Context, peerID int, filename string, data []byte) (string, error) {
+	params := url.Values{}
+	params.Set("peer_id", strconv.Itoa(peerID))
+	uploadServer := models.UploadServer{}
+	if err := b.Call(ctx, "photos.getMessagesUploadServer", params, &uploadServer); err != nil {
+		return "", err
+	}
+
+	uploaded := models.PhotoUpload{}
+	if err := b.uploadFile(ctx, uploadServer.UploadURL, "photo", filename, data, &uploaded); err != nil {
+		return "", err
+	}
+	if uploaded.Photo == "" || uploaded.Photo == "[]" {
+		return "", errors.New("upload server didn't accept the photo")
+	}
+
+	params = url.Values{}
+	params.Set("server", strconv.Itoa(uploaded.Server))
+	params.Set("photo", uploaded.Photo)
+	params.Set("hash", uploaded.Hash)
+	saved := []models.SavedPhoto{}
+	if err := b.Call(ctx, "photos.saveMessagesPhoto", params, &saved); err != nil {
+		return "", err
+	}
+	if len(saved) == 0 {
+		return "", errors.New("photos.saveMessagesPhoto returned no photos")
+	}
+	return attachment("photo", saved[0].OwnerID, saved[0].ID, saved[0].AccessKey), nil
+}
+
+// UploadPhotoFromFile uploads an image file from disk, see UploadPhoto.
+func (b *Bot) UploadPhotoFromFile(ctx context.Context, peerID int, filePath string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading the photo: %w", err)
+	}
+	return b.UploadPhoto(ctx, peerID, filepath.Base(filePath), data)
+}
+
+// UploadPhotoFromURL downloads an image and uploads it to VK, see UploadPhoto.
+// The file name is taken from the last element of the URL path.
+func (b *Bot) UploadPhotoFromURL(ctx context.Context, peerID int, imageUrl string) (string, error) {
+	data, filename, err := b.download(ctx, imageUrl)
+	if err != nil {
+		return "", err
+	}
+	return b.UploadPhoto(ctx, peerID, filename, data)
+}
+
+// UploadDocument uploads a file, e.g. a PDF, so it can be attached to a message in the given conversation.
+//
+// Parameters:
+//   - ctx: The context the requests are bound to.
+//   - peerID: The ID of the conversation the document will be sent to.
+//   - filename: The name of the file shown to the user.
+//   - title: The title of the document, the file name is used if it is empty.
+//   - data: The content of the file.
+//
+// Returns:
+//   - string: The attachment string to pass to WithAttachment, e.g. "doc-123_456".
+//     It can be combined with photos, text and a keyboard in one message.
+//   - error: An error if any of the steps failed.
+//
+// Note:
+//   - The upload takes three steps: docs.getMessagesUploadServer returns the upload address,
+//     the file is posted there as multipart form data, and docs.save saves the uploaded file.
+func (b *Bot) UploadDocument(ctx context.Context, peerID int, filename string, title string, data []byte) (string, error) {
+	params := url.Values{}
+	params.Set("type", "doc")
+	params.Set("peer_id", strconv.Itoa(peerID))
+	uploadServer := models.UploadServer{}
+	if err := b.Call(ctx, "docs.getMessagesUploadServer", params, &uploadServer); err != nil {
+		return "", err
+	}
+
+	uploaded := models.DocumentUpload{}
+	if err := b.uploadFile(ctx, uploadServer.UploadURL, "file", filename, data, &uploaded); err != nil {
+		return "", err
+	}
+	if uploaded.File == "" {
+		return "", fmt.Errorf("upload server didn't accept the document: %s", uploaded.Error)
+	}
+
+	if title == "" {
+		title = filename
+	}
+	params = url.Values{}
+	params.Set("file", uploaded.File)
+	params.Set("title", title)
+	saved := models.SavedDocument{}
+	if err := b.Call(ctx, "docs.save", params, &saved); err != nil {
+		return "", err
+	}
+	if saved.Doc.ID == 0 {
+		return "", fmt.Errorf("docs.save returned no document of type %q", saved.Type)
+	}
+	return attachment("doc", saved.Doc.OwnerID, saved.Doc.ID, saved.Doc.AccessKey), nil
+}
+
+// UploadDocumentFromFile uploads a file from disk, see UploadDocument.
+func (b *Bot) UploadDocumentFromFile(ctx context.Context, peerID int, filePath string, title string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading the document: %w", err)
+	}
+	return b.UploadDocument(ctx, peerID, filepath.Base(filePath), title, data)
+}
+
+// UploadDocumentFromURL downloads a file and uploads it to VK, see UploadDocument.
+// The file name is taken from the last element of the URL path.
+func (b *Bot) UploadDocumentFromURL(ctx context.Context, peerID int, fileUrl string, title string) (string, error) {
+	data, filename, err := b.download(ctx, fileUrl)
+	if err != nil {
+		return "", err
+	}
+	return b.UploadDocument(ctx, peerID, filename, title, data)
+}
+
+// attachment formats the attachment string of a media object, the access key is optional.
+func attachment(mediaType string, ownerID int, mediaID int, accessKey string) string {
+	result := fmt.Sprintf("%s%d_%d", mediaType, ownerID, mediaID)
+	if accessKey != "" {
+		result += "_" + accessKey
+	}
+	return result
+}
+
+// maxDownloadSize is the largest file download reads, the size limit of the documents uploaded to VK.
+// Photos are limited to 50 MB by VK, larger ones are rejected by the upload server.
+var maxDownloadSize int64 = 200 << 20
+
+// commonExtensions lists the extensions used for the most common media types,
+// the system MIME table may return rarely used ones for them first.
+var commonExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+}
+
+// extensionByType returns the file extension for the Content-Type, or an empty string if it's unknown.
+func extensionByType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if extension, ok := commonExtensions[mediaType]; ok {
+		return extension
+	}
+	if extensions, _ := mime.ExtensionsByType(mediaType); len(extensions) > 0 {
+		return extensions[0]
+	}
+	return ""
+}
+
+// uploadFile posts the file as multipart form data to an upload address returned by the VK API
+// and unmarshals the JSON response into result.
+// The request is retried according to the bot's retry policy.
+func (b *Bot) uploadFile(ctx context.Context, uploadUrl string, field string, filename string, data []byte, result interface{}) error {
+	if uploadUrl == "" {
+		return errors.New("upload address is empty")
+	}
+
+	body := bytes.Buffer{}
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		return fmt.Errorf("error creating the upload form: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return fmt.Errorf("error creating the upload form: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error creating the upload form: %w", err)
+	}
+
+	return b.Retry.Do(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadUrl, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return retry.Permanent(fmt.Errorf("error creating the upload request: %w", err))
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		resp, err := b.Client.HTTPClient().Do(req)
+		if err != nil {
+			return fmt.Errorf("error uploading the file: %w", err)
+		}
+		defer resp.Body.Close()
+
+		response, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("error reading the upload response: %w", err)
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("unexpected upload response status: %s", resp.Status)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return retry.Permanent(fmt.Errorf("unexpected upload response status: %s", resp.Status))
+		}
+		if err := json.Unmarshal(response, result); err != nil {
+			return retry.Permanent(fmt.Errorf("error unmarshalling the upload response: %w", err))
+		}
+		return nil
+	})
+}
+
+// download fetches a file to upload it to VK and returns its content and name.
+// If the name taken from the URL has no extension, it is added based on the Content-Type of the response,
+// since VK detects the file format by the extension.
+// The request is retried according to the bot's retry policy, an address that isn't an http(s) URL fails right away.
+// Files larger than VK accepts are not read to the end, see maxDownloadSize.
+func (b *Bot) download(ctx context.Context, fileUrl string) ([]byte, string, error) {
+	parsed, err := url.Parse(fileUrl)
+	if err != nil {
+		return nil, "", fmt.Errorf("error parsing the file address: %w", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, "", fmt.Errorf("file address %q is not an http(s) URL", fileUrl)
+	}
+	filename := path.Base(parsed.Path)
+	if filename == "." || filename == "/" {
+		filename = "file"
+	}
+
+	var data []byte
+	err = b.Retry.Do(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileUrl, nil)
+		if err != nil {
+			return retry.Permanent(fmt.Errorf("error creating the download request: %w", err))
+		}
+
+		resp, err := b.Client.HTTPClient().Do(req)
+		if err != nil {
+			return fmt.Errorf("error downloading the file: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("unexpected download response status: %s", resp.Status)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return retry.Permanent(fmt.Errorf("unexpected download response status: %s", resp.Status))
+		}
+
+		// one byte over the limit is enough to tell that the file is too large
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+		if err != nil {
+			return fmt.Errorf("error reading the file: %w", err)
+		}
+		if int64(len(data)) > maxDownloadSize {
+			return retry.Permanent(fmt.Errorf("file is larger than %d bytes, VK doesn't accept it", maxDownloadSize))
+		}
+		if path.Ext(filename) == "" {
+			filename += extensionByType(resp.Header.Get("Content-Type"))
+		}
+		return nil
+	})
+	return data, filename, err
+}
@@ -0,0 +1,292 @@
+package bot
+
+import (
+	"context"
+	"goVkBot/internal/config"
+	"goVkBot/internal/retry"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownload(t *testing.T) {
+	requests := atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("image"))
+	}))
+	defer srv.Close()
+
+	b := &Bot{
+		Retry:  retry.Policy{InitialDelay: time.Second, MaxAttempts: 5},
+		Client: config.Client{Timeout: time.Second * 5},
+	}
+
+	tests := []struct {
+		name         string
+		fileUrl      string
+		wantErr      bool
+		wantFilename string
+		wantRequests int32
+	}{
+		{"http URL", srv.URL + "/cats/cat", false, "cat.png", 1},
+		{"empty address", "", true, "", 0},
+		{"unsupported scheme", "ftp://example.com/cat.png", true, "", 0},
+		{"no host", "http:///cat.png", true, "", 0},
+		{"malformed URL", "http://[::1", true, "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests.Store(0)
+			start := time.Now()
+			data, filename, err := b.download(context.Background(), test.fileUrl)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("download returned %v, want error: %v", err, test.wantErr)
+			}
+			// a broken address must not be retried
+			if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+				t.Errorf("download returned after %v, want no retries", elapsed)
+			}
+			if got := requests.Load(); got != test.wantRequests {
+				t.Errorf("made %d requests, want %d", got, test.wantRequests)
+			}
+			if !test.wantErr && (string(data) != "image" || filename != test.wantFilename) {
+				t.Errorf("downloaded %q as %q, want \"image\" as %q", data, filename, test.wantFilename)
+			}
+		})
+	}
+}
+
+func TestDownloadTooLarge(t *testing.T) {
+	requests := atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("large image"))
+	}))
+	defer srv.Close()
+
+	defer func(size int64) { maxDownloadSize = size }(maxDownloadSize)
+	maxDownloadSize = 5
+
+	b := &Bot{
+		Retry:  retry.Policy{InitialDelay: time.Millisecond, MaxAttempts: 3},
+		Client: config.Client{Timeout: time.Second * 5},
+	}
+	if _, _, err := b.download(context.Background(), srv.URL+"/cat.png"); err == nil {
+		t.Error("download of a file over the limit returned nil, want an error")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("made %d requests, want 1 without retries", got)
+	}
+}
+
+// fakeUploadVK serves the upload flow of VK: the upload server address, the upload server itself and the save method.
+type fakeUploadVK struct {
+	// uploadResponse is the answer of the upload server
+	uploadResponse string
+	// saveResponse is the answer of the save method
+	saveResponse string
+
+	mu         sync.Mutex
+	uploaded   map[string]string
+	saveParams url.Values
+	calls      []string
+}
+
+// newFakeUploadVK starts the fake VK and returns a bot using it.
+// uploadMethod and saveMethod are the names of the methods returning the upload address and saving the file.
+func newFakeUploadVK(t *testing.T, vk *fakeUploadVK, uploadMethod string, saveMethod string) *Bot {
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/method/"+uploadMethod, func(w http.ResponseWriter, r *http.Request) {
+		vk.record(uploadMethod)
+		io.WriteString(w, `{"response":{"upload_url":"`+srv.URL+`/upload"}}`)
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		vk.record("upload")
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("error parsing the upload: %v", err)
+		}
+		vk.mu.Lock()
+		vk.uploaded = map[string]string{}
+		for field, files := range r.MultipartForm.File {
+			file, err := files[0].Open()
+			if err != nil {
+				t.Errorf("error opening the uploaded file: %v", err)
+				continue
+			}
+			data, _ := io.ReadAll(file)
+			file.Close()
+			vk.uploaded[field] = files[0].Filename + ":" + string(data)
+		}
+		vk.mu.Unlock()
+		io.WriteString(w, vk.uploadResponse)
+	})
+	mux.HandleFunc("/method/"+saveMethod, func(w http.ResponseWriter, r *http.Request) {
+		vk.record(saveMethod)
+		r.ParseForm()
+		vk.mu.Lock()
+		vk.saveParams = r.PostForm
+		vk.mu.Unlock()
+		io.WriteString(w, vk.saveResponse)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return &Bot{
+		AccessToken: "token",
+		Retry:       retry.Policy{InitialDelay: time.Millisecond, MaxAttempts: 3},
+		Client:      config.Client{BaseURL: srv.URL + "/method", APIVersion: "5.131", Timeout: time.Second * 5},
+	}
+}
+
+// record remembers the called step of the upload.
+func (vk *fakeUploadVK) record(step string) {
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+	vk.calls = append(vk.calls, step)
+}
+
+func TestUploadPhoto(t *testing.T) {
+	tests := []struct {
+		name           string
+		uploadResponse string
+		saveResponse   string
+		want           string
+		wantErr        bool
+		wantCalls      []string
+	}{
+		{
+			name:           "uploaded",
+			uploadResponse: `{"server":123,"photo":"[{\"photo\":\"abc\"}]","hash":"h1"}`,
+			saveResponse:   `{"response":[{"id":456,"owner_id":-1,"access_key":"key"}]}`,
+			want:           "photo-1_456_key",
+			wantCalls:      []string{"photos.getMessagesUploadServer", "upload", "photos.saveMessagesPhoto"},
+		},
+		{
+			name:           "rejected by the upload server",
+			uploadResponse: `{"server":123,"photo":"[]","hash":"h1"}`,
+			wantErr:        true,
+			wantCalls:      []string{"photos.getMessagesUploadServer", "upload"},
+		},
+		{
+			name:           "nothing saved",
+			uploadResponse: `{"server":123,"photo":"[{\"photo\":\"abc\"}]","hash":"h1"}`,
+			saveResponse:   `{"response":[]}`,
+			wantErr:        true,
+			wantCalls:      []string{"photos.getMessagesUploadServer", "upload", "photos.saveMessagesPhoto"},
+		},
+		{
+			name:           "save error",
+			uploadResponse: `{"server":123,"photo":"[{\"photo\":\"abc\"}]","hash":"h1"}`,
+			saveResponse:   `{"error":{"error_code":121,"error_msg":"Invalid hash"}}`,
+			wantErr:        true,
+			wantCalls:      []string{"photos.getMessagesUploadServer", "upload", "photos.saveMessagesPhoto"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vk := &fakeUploadVK{uploadResponse: test.uploadResponse, saveResponse: test.saveResponse}
+			b := newFakeUploadVK(t, vk, "photos.getMessagesUploadServer", "photos.saveMessagesPhoto")
+
+			got, err := b.UploadPhoto(context.Background(), 1, "cat.jpg", []byte("image"))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("UploadPhoto returned %v, want error: %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("UploadPhoto = %q, want %q", got, test.want)
+			}
+			if !reflect.DeepEqual(vk.calls, test.wantCalls) {
+				t.Errorf("made calls %v, want %v", vk.calls, test.wantCalls)
+			}
+			if vk.uploaded["photo"] != "cat.jpg:image" {
+				t.Errorf("uploaded %v, want the image in the photo field", vk.uploaded)
+			}
+			if test.saveResponse != "" {
+				params := vk.saveParams
+				if params.Get("server") != "123" || params.Get("photo") != `[{"photo":"abc"}]` || params.Get("hash") != "h1" {
+					t.Errorf("saved the photo with params %v, want the ones returned by the upload server", params)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadDocument(t *testing.T) {
+	tests := []struct {
+		name           string
+		title          string
+		uploadResponse string
+		saveResponse   string
+		want           string
+		wantTitle      string
+		wantErr        string
+		wantCalls      []string
+	}{
+		{
+			name:           "uploaded",
+			title:          "Меню",
+			uploadResponse: `{"file":"f1"}`,
+			saveResponse:   `{"response":{"type":"doc","doc":{"id":789,"owner_id":1,"title":"Меню"}}}`,
+			want:           "doc1_789",
+			wantTitle:      "Меню",
+			wantCalls:      []string{"docs.getMessagesUploadServer", "upload", "docs.save"},
+		},
+		{
+			name:           "file name as title",
+			uploadResponse: `{"file":"f1"}`,
+			saveResponse:   `{"response":{"type":"doc","doc":{"id":789,"owner_id":1,"access_key":"key"}}}`,
+			want:           "doc1_789_key",
+			wantTitle:      "menu.pdf",
+			wantCalls:      []string{"docs.getMessagesUploadServer", "upload", "docs.save"},
+		},
+		{
+			name:           "rejected by the upload server",
+			uploadResponse: `{"file":"","error":"file type not allowed"}`,
+			wantErr:        "file type not allowed",
+			wantCalls:      []string{"docs.getMessagesUploadServer", "upload"},
+		},
+		{
+			name:           "saved as another type",
+			uploadResponse: `{"file":"f1"}`,
+			saveResponse:   `{"response":{"type":"audio_message","audio_message":{"id":1}}}`,
+			wantErr:        `no document of type "audio_message"`,
+			wantCalls:      []string{"docs.getMessagesUploadServer", "upload", "docs.save"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vk := &fakeUploadVK{uploadResponse: test.uploadResponse, saveResponse: test.saveResponse}
+			b := newFakeUploadVK(t, vk, "docs.getMessagesUploadServer", "docs.save")
+
+			got, err := b.UploadDocument(context.Background(), 1, "menu.pdf", test.title, []byte("%PDF"))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("UploadDocument returned %v, want an error containing %q", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("UploadDocument returned %v", err)
+			}
+			if got != test.want {
+				t.Errorf("UploadDocument = %q, want %q", got, test.want)
+			}
+			if !reflect.DeepEqual(vk.calls, test.wantCalls) {
+				t.Errorf("made calls %v, want %v", vk.calls, test.wantCalls)
+			}
+			if vk.uploaded["file"] != "menu.pdf:%PDF" {
+				t.Errorf("uploaded %v, want the document in the file field", vk.uploaded)
+			}
+			if test.wantTitle != "" && (vk.saveParams.Get("file") != "f1" || vk.saveParams.Get("title") != test.wantTitle) {
+				t.Errorf("saved the document with params %v, want file f1 and title %q", vk.saveParams, test.wantTitle)
+			}
+		})
+	}
+}
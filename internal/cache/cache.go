@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"container/list"
+	"time"
+)
+
+// Cache is a map that keeps at most capacity entries and forgets every entry after ttl without updates,
+// so memory stays bounded no matter how many keys are stored.
+// When the cache is full, the entry updated the longest time ago is evicted first.
+// A Cache is not safe for concurrent use, its users guard it with their own mutex,
+// since they usually need to read and update an entry in one step.
+type Cache[K comparable, V any] struct {
+	capacity int
+	ttl      time.Duration
+	entries  map[K]*list.Element
+	// order keeps the entries from the least to the most recently updated one
+	order *list.List
+}
+
+// entry is a value stored in the cache together with the time it was last updated.
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	updatedAt time.Time
+}
+
+// New creates an empty cache.
+//
+// Parameters:
+//   - capacity: The maximum number of entries, the ones updated the longest time ago are evicted first.
+//     Values below 1 are treated as 1.
+//   - ttl: How long an entry is kept after its last update.
+func New[K comparable, V any](capacity int, ttl time.Duration) *Cache[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Cache[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[K]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the value stored for the key, if it hasn't expired.
+// Reading an entry doesn't extend its lifetime, only Set does.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.forget(time.Now())
+	element, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return element.Value.(*entry[K, V]).value, true
+}
+
+// Set stores the value for the key and restarts its lifetime.
+// If the cache is full, the entry updated the longest time ago is evicted.
+func (c *Cache[K, V]) Set(key K, value V) {
+	now := time.Now()
+	c.forget(now)
+
+	if element, ok := c.entries[key]; ok {
+		stored := element.Value.(*entry[K, V])
+		stored.value, stored.updatedAt = value, now
+		c.order.MoveToBack(element)
+		return
+	}
+	c.entries[key] = c.order.PushBack(&entry[K, V]{key: key, value: value, updatedAt: now})
+	if c.order.Len() > c.capacity {
+		c.remove(c.order.Front())
+	}
+}
+
+// Len returns the number of entries in the cache, including the expired ones not forgotten yet.
+func (c *Cache[K, V]) Len() int {
+	return c.order.Len()
+}
+
+// forget removes the entries not updated for longer than ttl.
+// Entries are kept in the order of their last update, so it stops at the first one that is still fresh.
+func (c *Cache[K, V]) forget(now time.Time) {
+	for element := c.order.Front(); element != nil; element = c.order.Front() {
+		if now.Sub(element.Value.(*entry[K, V]).updatedAt) < c.ttl {
+			return
+		}
+		c.remove(element)
+	}
+}
+
+// remove deletes the element from both the list and the map.
+func (c *Cache[K, V]) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry[K, V]).key)
+}
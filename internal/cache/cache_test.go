@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	// step sets the key to the value after waiting for wait, a nil value leaves the cache as is
+	type step struct {
+		key   string
+		value *int
+		wait  time.Duration
+	}
+	one, two, three := 1, 2, 3
+
+	tests := []struct {
+		name     string
+		capacity int
+		ttl      time.Duration
+		steps    []step
+		// want maps the keys to the values expected at the end, missing keys are marked with 0
+		want map[string]int
+	}{
+		{
+			name:     "capacity evicts the oldest",
+			capacity: 2,
+			ttl:      time.Minute,
+			steps:    []step{{"a", &one, 0}, {"b", &two, 0}, {"c", &three, 0}},
+			want:     map[string]int{"a": 0, "b": 2, "c": 3},
+		},
+		{
+			name:     "update refreshes the entry",
+			capacity: 2,
+			ttl:      time.Minute,
+			// "a" is updated after "b", so "b" is evicted instead
+			steps: []step{{"a", &one, 0}, {"b", &two, 0}, {"a", &three, 0}, {"c", &one, 0}},
+			want:  map[string]int{"a": 3, "b": 0, "c": 1},
+		},
+		{
+			name:     "capacity below 1",
+			capacity: 0,
+			ttl:      time.Minute,
+			steps:    []step{{"a", &one, 0}, {"b", &two, 0}},
+			want:     map[string]int{"a": 0, "b": 2},
+		},
+		{
+			name:     "ttl forgets old entries",
+			capacity: 10,
+			ttl:      time.Millisecond * 50,
+			steps:    []step{{"a", &one, 0}, {"b", &two, time.Millisecond * 30}, {"", nil, time.Millisecond * 30}},
+			want:     map[string]int{"a": 0, "b": 2},
+		},
+		{
+			name:     "ttl starts again on update",
+			capacity: 10,
+			ttl:      time.Millisecond * 50,
+			steps:    []step{{"a", &one, 0}, {"a", &two, time.Millisecond * 30}, {"", nil, time.Millisecond * 30}},
+			want:     map[string]int{"a": 2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := New[string, int](test.capacity, test.ttl)
+			for _, step := range test.steps {
+				time.Sleep(step.wait)
+				if step.value != nil {
+					cache.Set(step.key, *step.value)
+				}
+			}
+			for key, want := range test.want {
+				got, ok := cache.Get(key)
+				if ok != (want != 0) || got != want {
+					t.Errorf("Get(%q) = %d, %v, want %d", key, got, ok, want)
+				}
+			}
+			if len(cache.entries) != cache.order.Len() {
+				t.Errorf("cache holds %d entries in the map and %d in the list", len(cache.entries), cache.order.Len())
+			}
+		})
+	}
+}
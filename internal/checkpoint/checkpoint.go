@@ -0,0 +1,57 @@
+package checkpoint
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store keeps the last processed long poll ts, so the bot can continue from it after a restart.
+type Store interface {
+	// Load returns the saved ts, or an empty string if nothing has been saved yet.
+	Load() (string, error)
+	// Save replaces the saved ts.
+	Save(ts string) error
+}
+
+// FileStore is a Store that keeps the ts in a file.
+type FileStore struct {
+	Path string
+}
+
+// Load reads the ts from the file.
+// A missing file is not an error, an empty string is returned in that case.
+func (f FileStore) Load() (string, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Save writes the ts to a temporary file next to the checkpoint, syncs it to disk and renames it,
+// so a crash or a power loss in the middle of writing leaves either the old or the new checkpoint behind.
+func (f FileStore) Save(ts string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(ts); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
@@ -0,0 +1,53 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	store := FileStore{Path: filepath.Join(dir, "longpoll.ts")}
+
+	ts, err := store.Load()
+	if err != nil || ts != "" {
+		t.Fatalf("Load of a missing file = %q, %v, want an empty ts and no error", ts, err)
+	}
+
+	for _, want := range []string{"42", "43"} {
+		if err := store.Save(want); err != nil {
+			t.Fatalf("Save(%q) returned %v", want, err)
+		}
+		ts, err := store.Load()
+		if err != nil || ts != want {
+			t.Errorf("Load after Save(%q) = %q, %v", want, ts, err)
+		}
+	}
+
+	// only the checkpoint is left, the temporary files are renamed or removed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("error reading the directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the checkpoint", len(entries))
+	}
+}
+
+func TestFileStoreTrimsSpace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "longpoll.ts")
+	if err := os.WriteFile(path, []byte("42\n"), 0o644); err != nil {
+		t.Fatalf("error writing the file: %v", err)
+	}
+	if ts, err := (FileStore{Path: path}).Load(); err != nil || ts != "42" {
+		t.Errorf("Load = %q, %v, want \"42\"", ts, err)
+	}
+}
+
+func TestFileStoreSaveError(t *testing.T) {
+	store := FileStore{Path: filepath.Join(t.TempDir(), "missing", "longpoll.ts")}
+	if err := store.Save("42"); err == nil {
+		t.Error("Save into a missing directory returned nil, want an error")
+	}
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"net/http"
+	"time"
+)
+
+// Client describes how the bot talks to the VK API and the external services it uses.
+// Start from Default and override the fields that need to be changed.
+//
+// Fields:
+//   - BaseURL: The base URL of the VK API methods, e.g. "https://api.vk.com/method".
+//   - APIVersion: The VK API version sent with every request.
+//   - Timeout: The timeout of a single request. Long poll requests get the long poll wait time on top of it.
+//   - Transport: The transport used for all requests, http.DefaultTransport if nil.
+//   - WeatherURL: The forecast endpoint of the open-meteo weather service.
+//   - CatURL: The base URL of the Cataas cat image service.
+type Client struct {
+	BaseURL    string
+	APIVersion string
+	Timeout    time.Duration
+	Transport  http.RoundTripper
+	WeatherURL string
+	CatURL     string
+}
+
+// Default returns the configuration pointing to the real services.
+func Default() Client {
+	return Client{
+		BaseURL:    "https://api.vk.com/method",
+		APIVersion: "5.131",
+		Timeout:    time.Second * 10,
+		WeatherURL: "https://api.open-meteo.com/v1/forecast",
+		CatURL:     "https://cataas.com",
+	}
+}
+
+// HTTPClient returns an http.Client with the configured timeout and transport.
+func (c Client) HTTPClient() *http.Client {
+	return c.HTTPClientWithTimeout(c.Timeout)
+}
+
+// HTTPClientWithTimeout returns an http.Client with the configured transport and the given timeout.
+// It is used for requests expected to take longer than usual, such as long polling.
+func (c Client) HTTPClientWithTimeout(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: c.Transport}
+}
@@ -0,0 +1,51 @@
+package dedup
+
+import (
+	"goVkBot/internal/cache"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Set remembers recently seen event IDs to detect updates delivered more than once.
+// It keeps at most capacity IDs and forgets every ID after ttl, so memory stays bounded
+// no matter how many updates are received.
+type Set struct {
+	mu      sync.Mutex
+	seen    *cache.Cache[string, struct{}]
+	dropped atomic.Uint64
+}
+
+// New creates an empty set.
+//
+// Parameters:
+//   - capacity: The maximum number of remembered IDs, the oldest ones are forgotten first. Values below 1 are treated as 1.
+//   - ttl: How long an ID is remembered.
+func New(capacity int, ttl time.Duration) *Set {
+	return &Set{seen: cache.New[string, struct{}](capacity, ttl)}
+}
+
+// Seen reports whether the event ID has already been seen and remembers it otherwise.
+// Every true result is counted as a dropped duplicate.
+// An empty event ID is never considered seen, since there is nothing to compare it by.
+func (s *Set) Seen(eventID string) bool {
+	if eventID == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a duplicate isn't stored again, so an ID is forgotten ttl after it was first seen
+	if _, ok := s.seen.Get(eventID); ok {
+		s.dropped.Add(1)
+		return true
+	}
+	s.seen.Set(eventID, struct{}{})
+	return false
+}
+
+// Dropped returns the number of duplicates detected so far.
+func (s *Set) Dropped() uint64 {
+	return s.dropped.Load()
+}
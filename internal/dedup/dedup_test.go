@@ -0,0 +1,104 @@
+package dedup
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetSeen(t *testing.T) {
+	// step checks Seen for the event ID after waiting for wait
+	type step struct {
+		eventID string
+		wait    time.Duration
+		want    bool
+	}
+	tests := []struct {
+		name        string
+		capacity    int
+		ttl         time.Duration
+		steps       []step
+		wantDropped uint64
+	}{
+		{
+			name:     "duplicate",
+			capacity: 10,
+			ttl:      time.Minute,
+			steps:    []step{{"a", 0, false}, {"b", 0, false}, {"a", 0, true}, {"a", 0, true}},
+			// every detected duplicate is counted
+			wantDropped: 2,
+		},
+		{
+			name:     "empty event ID",
+			capacity: 10,
+			ttl:      time.Minute,
+			steps:    []step{{"", 0, false}, {"", 0, false}},
+		},
+		{
+			name:     "capacity evicts the oldest ID",
+			capacity: 2,
+			ttl:      time.Minute,
+			steps:    []step{{"a", 0, false}, {"b", 0, false}, {"c", 0, false}, {"a", 0, false}, {"c", 0, true}},
+			// "a" is remembered again after it was evicted, which evicts "b"
+			wantDropped: 1,
+		},
+		{
+			name:        "capacity below 1",
+			capacity:    0,
+			ttl:         time.Minute,
+			steps:       []step{{"a", 0, false}, {"a", 0, true}, {"b", 0, false}, {"a", 0, false}},
+			wantDropped: 1,
+		},
+		{
+			name:     "ttl forgets old IDs",
+			capacity: 10,
+			ttl:      time.Millisecond * 50,
+			steps: []step{
+				{"a", 0, false},
+				{"b", time.Millisecond * 30, false},
+				// "a" has expired while "b" is still fresh
+				{"a", time.Millisecond * 30, false},
+				{"b", 0, true},
+			},
+			wantDropped: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set := New(test.capacity, test.ttl)
+			for i, step := range test.steps {
+				time.Sleep(step.wait)
+				if got := set.Seen(step.eventID); got != step.want {
+					t.Errorf("step %d: Seen(%q) = %v, want %v", i+1, step.eventID, got, step.want)
+				}
+			}
+			if got := set.Dropped(); got != test.wantDropped {
+				t.Errorf("Dropped() = %d, want %d", got, test.wantDropped)
+			}
+		})
+	}
+}
+
+func TestSetConcurrentUse(t *testing.T) {
+	set := New(1000, time.Minute)
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				set.Seen(strconv.Itoa(i))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every ID was seen by all 8 workers, only the first one of them saw it as new
+	if got := set.Dropped(); got != 700 {
+		t.Errorf("Dropped() = %d, want 700", got)
+	}
+	if got := set.seen.Len(); got != 100 {
+		t.Errorf("set holds %d IDs, want 100", got)
+	}
+}
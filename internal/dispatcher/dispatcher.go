@@ -0,0 +1,101 @@
+package dispatcher
+
+import (
+	"context"
+	"goVkBot/internal/models"
+	"sync"
+)
+
+// Handler processes a single update.
+type Handler func(update models.Update)
+
+// job is a dispatched update together with the function called once it is handled.
+type job struct {
+	update models.Update
+	done   func()
+}
+
+// Dispatcher processes updates concurrently with a fixed number of workers.
+// Every worker has its own bounded queue and all updates of one peer are sent to the same worker,
+// so updates from different peers are handled in parallel while the updates of one peer
+// are handled one by one in the order they were dispatched.
+type Dispatcher struct {
+	queues  []chan job
+	handler Handler
+	wg      sync.WaitGroup
+}
+
+// New creates a dispatcher and starts its workers.
+//
+// Parameters:
+//   - workers: The number of updates handled at the same time, values below 1 are treated as 1.
+//   - queueSize: The number of updates waiting in the queue of every worker.
+//   - handler: The function called for every dispatched update.
+func New(workers int, queueSize int, handler Handler) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	d := &Dispatcher{queues: make([]chan job, workers), handler: handler}
+	for i := range d.queues {
+		d.queues[i] = make(chan job, queueSize)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+	return d
+}
+
+// Dispatch puts the update into the queue of the worker responsible for its peer.
+// If the queue is full, Dispatch blocks until there is room, which slows down the receiving side
+// instead of piling up updates in memory.
+// Dispatch must not be called after Shutdown.
+//
+// Parameters:
+//   - update: The update to handle.
+//   - done: The function called by the worker after the handler returns, e.g. to save a checkpoint (optional).
+func (d *Dispatcher) Dispatch(update models.Update, done func()) {
+	d.queues[d.worker(update.PeerID())] <- job{update: update, done: done}
+}
+
+// Shutdown stops accepting updates and waits until the queued ones are handled or the context is done.
+// It returns the context error if the updates weren't handled in time.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// worker returns the index of the worker responsible for the peer.
+func (d *Dispatcher) worker(peerID int) int {
+	if peerID < 0 {
+		peerID = -peerID
+	}
+	return peerID % len(d.queues)
+}
+
+// work handles the updates from the queue until it is closed.
+func (d *Dispatcher) work(queue <-chan job) {
+	defer d.wg.Done()
+	for queued := range queue {
+		d.handler(queued.update)
+		if queued.done != nil {
+			queued.done()
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"goVkBot/internal/models"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newUpdate creates a message_new update from the peer with the event ID telling the updates apart.
+func newUpdate(peerID int, eventID string) models.Update {
+	return models.Update{
+		Type:    "message_new",
+		EventID: eventID,
+		Object:  models.MessageNew{Message: models.Message{PeerID: peerID}},
+	}
+}
+
+func TestDispatcherKeepsPeerOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		queue   int
+		peers   int
+	}{
+		{"single worker", 1, 10, 5},
+		{"more peers than workers", 3, 2, 10},
+		{"more workers than peers", 8, 0, 3},
+		{"negative peer IDs", 4, 5, -4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mu := sync.Mutex{}
+			handled := map[int][]int{}
+			d := New(test.workers, test.queue, func(update models.Update) {
+				// give the other workers a chance to overtake
+				time.Sleep(time.Microsecond * 100)
+				number, _ := strconv.Atoi(update.EventID)
+				mu.Lock()
+				handled[update.PeerID()] = append(handled[update.PeerID()], number)
+				mu.Unlock()
+			})
+
+			peers := test.peers
+			step := 1
+			if peers < 0 {
+				peers, step = -peers, -1
+			}
+			const perPeer = 20
+			for i := 0; i < perPeer; i++ {
+				for peer := 1; peer <= peers; peer++ {
+					d.Dispatch(newUpdate(peer*step, strconv.Itoa(i)), nil)
+				}
+			}
+			if err := d.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown returned %v", err)
+			}
+
+			if len(handled) != peers {
+				t.Fatalf("got updates of %d peers, want %d", len(handled), peers)
+			}
+			for peer, numbers := range handled {
+				if len(numbers) != perPeer {
+					t.Errorf("peer %d: got %d updates, want %d", peer, len(numbers), perPeer)
+				}
+				for i, number := range numbers {
+					if number != i {
+						t.Errorf("peer %d: got updates in order %v", peer, numbers)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcherCallsDoneAfterHandler(t *testing.T) {
+	handled := atomic.Int32{}
+	d := New(2, 1, func(update models.Update) {
+		handled.Add(1)
+	})
+
+	done := make(chan int32, 1)
+	d.Dispatch(newUpdate(1, "1"), func() { done <- handled.Load() })
+	d.Dispatch(newUpdate(2, "2"), nil)
+
+	select {
+	case count := <-done:
+		if count < 1 {
+			t.Errorf("done was called before the update was handled")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("done wasn't called")
+	}
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned %v", err)
+	}
+}
+
+func TestDispatcherBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	d := New(1, 1, func(update models.Update) {
+		started <- struct{}{}
+		<-release
+	})
+
+	// the first update is being handled, the second one waits in the queue
+	d.Dispatch(newUpdate(1, "1"), nil)
+	<-started
+	d.Dispatch(newUpdate(1, "2"), nil)
+
+	dispatched := make(chan struct{})
+	go func() {
+		d.Dispatch(newUpdate(1, "3"), nil)
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+		t.Fatal("Dispatch didn't block with a full queue")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(release)
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Dispatch stayed blocked after the queue was drained")
+	}
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned %v", err)
+	}
+}
+
+func TestDispatcherShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		timeout time.Duration
+		wantErr error
+	}{
+		{"drains the queues", time.Millisecond * 5, time.Second * 5, nil},
+		{"times out", time.Second, time.Millisecond * 20, context.DeadlineExceeded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handled := atomic.Int32{}
+			d := New(2, 10, func(update models.Update) {
+				time.Sleep(test.delay)
+				handled.Add(1)
+			})
+			for i := 0; i < 10; i++ {
+				d.Dispatch(newUpdate(i, strconv.Itoa(i)), nil)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+			defer cancel()
+			err := d.Shutdown(ctx)
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Shutdown returned %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr == nil && handled.Load() != 10 {
+				t.Errorf("Shutdown returned with %d of 10 updates handled", handled.Load())
+			}
+			if test.wantErr != nil && handled.Load() == 10 {
+				t.Errorf("all updates were handled before the timeout, the test is too fast to check it")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package keyboard
+
+import (
+	"fmt"
+	"goVkBot/internal/models"
+	"strings"
+)
+
+// Adapt changes the keyboard to one the client of the user can show, based on the client_info of their last message.
+//
+// Parameters:
+//   - keyboard: The keyboard the bot wants to send.
+//   - client: The features supported by the client of the user.
+//
+// Returns:
+//   - models.Keyboard: The keyboard to send. It is empty if the client can't show keyboards at all,
+//     use TextMenu to offer the buttons as text then.
+//
+// Note:
+//   - Callback buttons are replaced with text buttons with the same label and payload if the client doesn't support them,
+//     other unsupported buttons are left out.
+//   - An inline keyboard is sent as a one-time regular keyboard if the client only supports regular keyboards,
+//     and a regular keyboard is sent as an inline one if the client only supports inline keyboards and it fits their limits.
+func Adapt(keyboard models.Keyboard, client models.ClientInfo) models.Keyboard {
+	if len(keyboard.Buttons) == 0 {
+		return keyboard
+	}
+
+	adapted := keyboard
+	adapted.Buttons = supportedButtons(keyboard.Buttons, client.ButtonActions)
+	if len(adapted.Buttons) == 0 {
+		return models.Keyboard{}
+	}
+
+	switch {
+	case adapted.Inline && !client.InlineKeyboard && client.Keyboard:
+		// an inline keyboard belongs to one message, a one-time keyboard is the closest a regular one gets to it
+		adapted.Inline, adapted.OneTime = false, true
+	case !adapted.Inline && !client.Keyboard && client.InlineKeyboard:
+		inline := adapted
+		inline.Inline, inline.OneTime = true, false
+		if Validate(inline) != nil {
+			return models.Keyboard{}
+		}
+		adapted = inline
+	case adapted.Inline && !client.InlineKeyboard, !adapted.Inline && !client.Keyboard:
+		return models.Keyboard{}
+	}
+	return adapted
+}
+
+// supportedButtons returns the rows of buttons the client supports, converting callback buttons to text buttons.
+// All buttons are kept if the client didn't report the supported button actions.
+func supportedButtons(rows [][]models.Button, actions []string) [][]models.Button {
+	if len(actions) == 0 {
+		return rows
+	}
+	supported := map[string]bool{TypeText: true}
+	for _, action := range actions {
+		supported[action] = true
+	}
+
+	adapted := [][]models.Button{}
+	for _, row := range rows {
+		adaptedRow := []models.Button{}
+		for _, button := range row {
+			if !supported[button.Action.Type] {
+				if button.Action.Type != TypeCallback {
+					continue
+				}
+				button.Action.Type = TypeText
+			}
+			adaptedRow = append(adaptedRow, button)
+		}
+		if len(adaptedRow) > 0 {
+			adapted = append(adapted, adaptedRow)
+		}
+	}
+	return adapted
+}
+
+// TextMenu describes the keyboard as text for clients that can't show keyboards.
+//
+// Parameters:
+//   - keyboard: The keyboard the bot wants to send.
+//
+// Returns:
+//   - string: The menu to add to the message, text and callback buttons are numbered
+//     so the user can choose one by replying with its number, links are listed as is.
+//   - []models.Button: The numbered buttons, the first one has number 1.
+//
+// Note:
+//   - Other buttons, e.g. location or vkpay, can't be used without a keyboard and are left out.
+func TextMenu(keyboard models.Keyboard) (string, []models.Button) {
+	lines := []string{}
+	choices := []models.Button{}
+	for _, row := range keyboard.Buttons {
+		for _, button := range row {
+			switch button.Action.Type {
+			case TypeText, TypeCallback:
+				choices = append(choices, button)
+				lines = append(lines, fmt.Sprintf("%d. %s", len(choices), button.Action.Label))
+			case TypeOpenLink:
+				lines = append(lines, fmt.Sprintf("%s: %s", button.Action.Label, button.Action.Link))
+			}
+		}
+	}
+	return strings.Join(lines, "\n"), choices
+}
@@ -0,0 +1,128 @@
+package keyboard
+
+import (
+	"goVkBot/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestAdapt(t *testing.T) {
+	allActions := []string{TypeText, TypeCallback, TypeOpenLink, TypeLocation, TypeVKPay, TypeOpenApp}
+	regular := models.Keyboard{Buttons: [][]models.Button{
+		{Text("Погода", ColorPrimary, `{"cmd":"weather"}`), Callback("Котик", "", `{"cmd":"cat"}`)},
+		{Location("")},
+	}}
+	inline := models.Keyboard{Inline: true, Buttons: [][]models.Button{
+		{Callback("Москва", "", `{"cmd":"weather"}`)},
+		{OpenLink("Google", "https://google.com", "")},
+	}}
+	large := models.Keyboard{Buttons: rows(MaxInlineRows+1, 1)}
+
+	callbackAsText := Text("Котик", "", `{"cmd":"cat"}`)
+
+	tests := []struct {
+		name     string
+		keyboard models.Keyboard
+		client   models.ClientInfo
+		want     models.Keyboard
+	}{
+		{
+			name:     "supported keyboard is kept",
+			keyboard: regular,
+			client:   models.ClientInfo{Keyboard: true, InlineKeyboard: true, ButtonActions: allActions},
+			want:     regular,
+		},
+		{
+			name:     "button actions not reported",
+			keyboard: regular,
+			client:   models.ClientInfo{Keyboard: true},
+			want:     regular,
+		},
+		{
+			name:     "callback becomes text",
+			keyboard: regular,
+			client:   models.ClientInfo{Keyboard: true, ButtonActions: []string{TypeText, TypeLocation}},
+			want: models.Keyboard{Buttons: [][]models.Button{
+				{Text("Погода", ColorPrimary, `{"cmd":"weather"}`), callbackAsText},
+				{Location("")},
+			}},
+		},
+		{
+			name:     "unsupported buttons are dropped",
+			keyboard: regular,
+			client:   models.ClientInfo{Keyboard: true, ButtonActions: []string{TypeText, TypeCallback}},
+			want: models.Keyboard{Buttons: [][]models.Button{
+				{Text("Погода", ColorPrimary, `{"cmd":"weather"}`), Callback("Котик", "", `{"cmd":"cat"}`)},
+			}},
+		},
+		{
+			name:     "no supported buttons",
+			keyboard: models.Keyboard{Buttons: [][]models.Button{{Location("")}}},
+			client:   models.ClientInfo{Keyboard: true, ButtonActions: []string{TypeText}},
+			want:     models.Keyboard{},
+		},
+		{
+			name:     "inline becomes one-time regular",
+			keyboard: inline,
+			client:   models.ClientInfo{Keyboard: true, ButtonActions: allActions},
+			want:     models.Keyboard{OneTime: true, Buttons: inline.Buttons},
+		},
+		{
+			name:     "regular becomes inline",
+			keyboard: models.Keyboard{OneTime: true, Buttons: [][]models.Button{{Text("Погода", "", "")}}},
+			client:   models.ClientInfo{InlineKeyboard: true, ButtonActions: allActions},
+			want:     models.Keyboard{Inline: true, Buttons: [][]models.Button{{Text("Погода", "", "")}}},
+		},
+		{
+			name:     "regular over the inline limits",
+			keyboard: large,
+			client:   models.ClientInfo{InlineKeyboard: true, ButtonActions: allActions},
+			want:     models.Keyboard{},
+		},
+		{
+			name:     "no keyboards",
+			keyboard: regular,
+			client:   models.ClientInfo{ButtonActions: allActions},
+			want:     models.Keyboard{},
+		},
+		{
+			name:     "empty keyboard",
+			keyboard: models.Keyboard{},
+			client:   models.ClientInfo{Keyboard: true},
+			want:     models.Keyboard{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Adapt(test.keyboard, test.client)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Adapt returned %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTextMenu(t *testing.T) {
+	keyboard := models.Keyboard{Buttons: [][]models.Button{
+		{Text("Погода", ColorPrimary, `{"cmd":"weather"}`), Callback("Котик", "", `{"cmd":"cat"}`)},
+		{OpenLink("Google", "https://google.com", "")},
+		{Location("")},
+		{Text("Забронировать столик", "", "")},
+	}}
+
+	menu, choices := TextMenu(keyboard)
+
+	wantMenu := "1. Погода\n2. Котик\nGoogle: https://google.com\n3. Забронировать столик"
+	if menu != wantMenu {
+		t.Errorf("got menu %q, want %q", menu, wantMenu)
+	}
+	wantChoices := []models.Button{keyboard.Buttons[0][0], keyboard.Buttons[0][1], keyboard.Buttons[3][0]}
+	if !reflect.DeepEqual(choices, wantChoices) {
+		t.Errorf("got choices %+v, want %+v", choices, wantChoices)
+	}
+
+	menu, choices = TextMenu(models.Keyboard{Buttons: [][]models.Button{{Location("")}}})
+	if menu != "" || len(choices) != 0 {
+		t.Errorf("got menu %q with %d choices for a keyboard without text buttons, want none", menu, len(choices))
+	}
+}
@@ -0,0 +1,287 @@
+package keyboard
+
+import (
+	"errors"
+	"fmt"
+	"goVkBot/internal/models"
+	"unicode/utf8"
+)
+
+// Limits of the keyboards imposed by VK, see https://dev.vk.com/ru/api/bots/development/keyboard
+const (
+	MaxRows          = 10
+	MaxColumns       = 5
+	MaxButtons       = 40
+	MaxInlineRows    = 6
+	MaxInlineColumns = 5
+	MaxInlineButtons = 10
+	MaxLabelLength   = 40
+	MaxPayloadLength = 255
+)
+
+// Colors of the text and callback buttons.
+const (
+	ColorPrimary   = "primary"
+	ColorSecondary = "secondary"
+	ColorNegative  = "negative"
+	ColorPositive  = "positive"
+)
+
+// Types of the buttons.
+const (
+	TypeText              = "text"
+	TypeCallback          = "callback"
+	TypeOpenLink          = "open_link"
+	TypeLocation          = "location"
+	TypeVKPay             = "vkpay"
+	TypeOpenApp           = "open_app"
+	TypeIntentSubscribe   = "intent_subscribe"
+	TypeIntentUnsubscribe = "intent_unsubscribe"
+)
+
+// Intents of the intent_subscribe and intent_unsubscribe buttons.
+const (
+	IntentConfirmedNotification = "confirmed_notification"
+	IntentNonPromoNewsletter    = "non_promo_newsletter"
+	IntentPromoNewsletter       = "promo_newsletter"
+)
+
+// Builder assembles a keyboard row by row and checks it against the VK limits, e.g.
+//
+//	menu, err := keyboard.New().
+//		Row(keyboard.Text("Погода", keyboard.ColorPrimary, payload)).
+//		Row(keyboard.OpenLink("Google", "https://google.com", "")).
+//		Build()
+type Builder struct {
+	keyboard models.Keyboard
+}
+
+// New creates a builder of a regular keyboard, shown in place of the system keyboard.
+func New() *Builder {
+	return &Builder{keyboard: models.Keyboard{Buttons: [][]models.Button{}}}
+}
+
+// NewInline creates a builder of an inline keyboard, shown under the message it is sent with.
+func NewInline() *Builder {
+	return &Builder{keyboard: models.Keyboard{Inline: true, Buttons: [][]models.Button{}}}
+}
+
+// OneTime makes the keyboard hide after the user presses one of its buttons.
+// Only regular keyboards can be one-time.
+func (b *Builder) OneTime() *Builder {
+	b.keyboard.OneTime = true
+	return b
+}
+
+// Row adds a row of buttons to the keyboard.
+func (b *Builder) Row(buttons ...models.Button) *Builder {
+	b.keyboard.Buttons = append(b.keyboard.Buttons, buttons)
+	return b
+}
+
+// Build returns the keyboard, or an error describing the first VK limit it breaks.
+func (b *Builder) Build() (models.Keyboard, error) {
+	if err := Validate(b.keyboard); err != nil {
+		return models.Keyboard{}, err
+	}
+	return b.keyboard, nil
+}
+
+// Text creates a button sending its label as a message from the user.
+// The color and the payload are optional.
+func Text(label string, color string, payload string) models.Button {
+	return newButton(TypeText, label, color, payload)
+}
+
+// Callback creates a button sending the message_event update to the bot without a message from the user.
+// The color and the payload are optional.
+func Callback(label string, color string, payload string) models.Button {
+	return newButton(TypeCallback, label, color, payload)
+}
+
+// OpenLink creates a button opening the link. The payload is optional.
+func OpenLink(label string, link string, payload string) models.Button {
+	button := newButton(TypeOpenLink, label, "", payload)
+	button.Action.Link = link
+	return button
+}
+
+// Location creates a button sending the location of the user, it arrives in the geo field of the message.
+// The button takes a whole row and has no label. The payload is optional.
+func Location(payload string) models.Button {
+	button := models.Button{}
+	button.Action.Type = TypeLocation
+	button.Action.Payload = payload
+	return button
+}
+
+// VKPay creates a button opening the VK Pay payment window, the payment arrives in the vkpay_transaction update.
+// The button takes a whole row and has no label.
+//
+// Parameters:
+//   - hash: The parameters of the payment, e.g. "action=pay-to-group&amount=100&group_id=1",
+//     see https://dev.vk.com/ru/api/bots/development/keyboard
+//   - payload: The payload of the button (optional).
+func VKPay(hash string, payload string) models.Button {
+	button := models.Button{}
+	button.Action.Type = TypeVKPay
+	button.Action.Hash = hash
+	button.Action.Payload = payload
+	return button
+}
+
+// OpenApp creates a button opening a VK Mini App, the app may answer with the app_payload update.
+//
+// Parameters:
+//   - label: The text of the button.
+//   - appID: The ID of the app.
+//   - ownerID: The ID of the group the app is installed in, or 0 to open it outside a group.
+//   - hash: The hash passed to the app in the URL after #, e.g. for navigation (optional).
+//   - payload: The payload of the button (optional).
+func OpenApp(label string, appID int, ownerID int, hash string, payload string) models.Button {
+	button := newButton(TypeOpenApp, label, "", payload)
+	button.Action.AppID = appID
+	button.Action.OwnerID = ownerID
+	button.Action.Hash = hash
+	return button
+}
+
+// IntentSubscribe creates a button subscribing the user to the messages of the group with the given intent.
+// The subscribe ID is only used by the newsletter intents and can be 0 otherwise.
+func IntentSubscribe(label string, peerID int, intent string, subscribeID int) models.Button {
+	return newIntentButton(TypeIntentSubscribe, label, peerID, intent, subscribeID)
+}
+
+// IntentUnsubscribe creates a button unsubscribing the user from the messages of the group with the given intent.
+// The subscribe ID is only used by the newsletter intents and can be 0 otherwise.
+func IntentUnsubscribe(label string, peerID int, intent string, subscribeID int) models.Button {
+	return newIntentButton(TypeIntentUnsubscribe, label, peerID, intent, subscribeID)
+}
+
+// newIntentButton creates an intent_subscribe or intent_unsubscribe button.
+func newIntentButton(buttonType string, label string, peerID int, intent string, subscribeID int) models.Button {
+	button := newButton(buttonType, label, "", "")
+	button.Action.PeerID = peerID
+	button.Action.Intent = intent
+	button.Action.SubscribeID = subscribeID
+	return button
+}
+
+// newButton creates a button of the given type.
+func newButton(buttonType string, label string, color string, payload string) models.Button {
+	button := models.Button{Color: color}
+	button.Action.Type = buttonType
+	button.Action.Label = label
+	button.Action.Payload = payload
+	return button
+}
+
+// Validate checks the keyboard against the VK limits, so a broken keyboard is reported before it is sent.
+//
+// Parameters:
+//   - keyboard: The keyboard to check, either built with a Builder or by hand.
+//
+// Returns:
+//   - error: An error describing the first limit the keyboard breaks, or nil if it is valid.
+//
+// Note:
+//   - Regular keyboards can have up to MaxRows rows of up to MaxColumns buttons and MaxButtons buttons in total,
+//     inline keyboards up to MaxInlineRows rows of up to MaxInlineColumns buttons and MaxInlineButtons buttons in total.
+//   - Labels can be up to MaxLabelLength characters long, payloads up to MaxPayloadLength characters.
+//   - Only text and callback buttons can have a color.
+//   - Location and vkpay buttons have no label and must be the only button in their row.
+func Validate(keyboard models.Keyboard) error {
+	maxRows, maxColumns, maxButtons := MaxRows, MaxColumns, MaxButtons
+	if keyboard.Inline {
+		maxRows, maxColumns, maxButtons = MaxInlineRows, MaxInlineColumns, MaxInlineButtons
+		if keyboard.OneTime {
+			return errors.New("inline keyboard can't be one-time")
+		}
+	}
+
+	if len(keyboard.Buttons) > maxRows {
+		return fmt.Errorf("keyboard has %d rows, at most %d are allowed", len(keyboard.Buttons), maxRows)
+	}
+	total := 0
+	for i, row := range keyboard.Buttons {
+		if len(row) == 0 {
+			return fmt.Errorf("row %d of the keyboard is empty", i+1)
+		}
+		if len(row) > maxColumns {
+			return fmt.Errorf("row %d of the keyboard has %d buttons, at most %d are allowed", i+1, len(row), maxColumns)
+		}
+		for _, button := range row {
+			if err := validateButton(button); err != nil {
+				return fmt.Errorf("%s button %q in row %d: %w", button.Action.Type, button.Action.Label, i+1, err)
+			}
+			if fullWidth(button) && len(row) > 1 {
+				return fmt.Errorf("%s button in row %d must be the only button in its row", button.Action.Type, i+1)
+			}
+		}
+		total += len(row)
+	}
+	if total > maxButtons {
+		return fmt.Errorf("keyboard has %d buttons, at most %d are allowed", total, maxButtons)
+	}
+	return nil
+}
+
+// fullWidth reports whether the button takes a whole row of the keyboard.
+func fullWidth(button models.Button) bool {
+	return button.Action.Type == TypeLocation || button.Action.Type == TypeVKPay
+}
+
+// validateButton checks a single button of a keyboard.
+func validateButton(button models.Button) error {
+	action := button.Action
+	if button.Color != "" && action.Type != TypeText && action.Type != TypeCallback {
+		return errors.New("only text and callback buttons can have a color")
+	}
+	switch action.Type {
+	case TypeText, TypeCallback:
+		switch button.Color {
+		case "", ColorPrimary, ColorSecondary, ColorNegative, ColorPositive:
+		default:
+			return fmt.Errorf("unknown color %q", button.Color)
+		}
+	case TypeOpenLink:
+		if action.Link == "" {
+			return errors.New("link is empty")
+		}
+	case TypeLocation:
+	case TypeVKPay:
+		if action.Hash == "" {
+			return errors.New("hash with the payment parameters is empty")
+		}
+	case TypeOpenApp:
+		if action.AppID == 0 {
+			return errors.New("app ID is empty")
+		}
+	case TypeIntentSubscribe, TypeIntentUnsubscribe:
+		switch action.Intent {
+		case IntentConfirmedNotification, IntentNonPromoNewsletter, IntentPromoNewsletter:
+		default:
+			return fmt.Errorf("unknown intent %q", action.Intent)
+		}
+		if action.PeerID == 0 {
+			return errors.New("peer ID is empty")
+		}
+	default:
+		return fmt.Errorf("unknown button type %q", action.Type)
+	}
+
+	if fullWidth(button) {
+		if action.Label != "" {
+			return errors.New("button can't have a label")
+		}
+	} else if action.Label == "" {
+		return errors.New("label is empty")
+	}
+	if length := utf8.RuneCountInString(action.Label); length > MaxLabelLength {
+		return fmt.Errorf("label is %d characters long, at most %d are allowed", length, MaxLabelLength)
+	}
+	if length := utf8.RuneCountInString(action.Payload); length > MaxPayloadLength {
+		return fmt.Errorf("payload is %d characters long, at most %d are allowed", length, MaxPayloadLength)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package keyboard
+
+import (
+	"goVkBot/internal/models"
+	"strings"
+	"testing"
+)
+
+// rows creates a keyboard of the given number of rows with the given number of text buttons each.
+func rows(count int, columns int) [][]models.Button {
+	buttons := make([][]models.Button, count)
+	for i := range buttons {
+		for j := 0; j < columns; j++ {
+			buttons[i] = append(buttons[i], Text("Кнопка", "", ""))
+		}
+	}
+	return buttons
+}
+
+func TestValidate(t *testing.T) {
+	coloredLink := OpenLink("Google", "https://google.com", "")
+	coloredLink.Color = ColorPrimary
+	labeledVKPay := VKPay("action=pay-to-group&amount=100&group_id=1", "")
+	labeledVKPay.Action.Label = "Оплатить"
+
+	tests := []struct {
+		name     string
+		keyboard models.Keyboard
+		// wantErr is a part of the expected error, empty if the keyboard is valid
+		wantErr string
+	}{
+		{"empty", models.Keyboard{}, ""},
+		{"max rows", models.Keyboard{Buttons: rows(MaxRows, 4)}, ""},
+		{"too many rows", models.Keyboard{Buttons: rows(MaxRows+1, 1)}, "keyboard has 11 rows, at most 10 are allowed"},
+		{"max columns", models.Keyboard{Buttons: rows(1, MaxColumns)}, ""},
+		{"too many columns", models.Keyboard{Buttons: rows(1, MaxColumns+1)}, "row 1 of the keyboard has 6 buttons, at most 5 are allowed"},
+		{"max buttons", models.Keyboard{Buttons: rows(MaxButtons/MaxColumns, MaxColumns)}, ""},
+		{"too many buttons", models.Keyboard{Buttons: append(rows(MaxButtons/MaxColumns, MaxColumns), rows(1, 1)...)}, "keyboard has 41 buttons, at most 40 are allowed"},
+		{"empty row", models.Keyboard{Buttons: [][]models.Button{{Text("Кнопка", "", "")}, {}}}, "row 2 of the keyboard is empty"},
+		{"inline max rows", models.Keyboard{Inline: true, Buttons: rows(MaxInlineRows, 1)}, ""},
+		{"inline too many rows", models.Keyboard{Inline: true, Buttons: rows(MaxInlineRows+1, 1)}, "keyboard has 7 rows, at most 6 are allowed"},
+		{"inline max columns", models.Keyboard{Inline: true, Buttons: rows(1, MaxInlineColumns)}, ""},
+		{"inline too many columns", models.Keyboard{Inline: true, Buttons: rows(1, MaxInlineColumns+1)}, "row 1 of the keyboard has 6 buttons, at most 5 are allowed"},
+		{"inline max buttons", models.Keyboard{Inline: true, Buttons: rows(MaxInlineButtons/MaxInlineColumns, MaxInlineColumns)}, ""},
+		{"inline too many buttons", models.Keyboard{Inline: true, Buttons: rows(MaxInlineRows, 2)}, "keyboard has 12 buttons, at most 10 are allowed"},
+		{"inline one-time", models.Keyboard{Inline: true, OneTime: true, Buttons: rows(1, 1)}, "inline keyboard can't be one-time"},
+		{"one-time", models.Keyboard{OneTime: true, Buttons: rows(1, 1)}, ""},
+		{"max label", models.Keyboard{Buttons: [][]models.Button{{Text(strings.Repeat("ж", MaxLabelLength), "", "")}}}, ""},
+		{"long label", models.Keyboard{Buttons: [][]models.Button{{Text(strings.Repeat("ж", MaxLabelLength+1), "", "")}}}, "label is 41 characters long, at most 40 are allowed"},
+		{"empty label", models.Keyboard{Buttons: [][]models.Button{{Text("", "", "")}}}, "label is empty"},
+		{"max payload", models.Keyboard{Buttons: [][]models.Button{{Text("Кнопка", "", strings.Repeat("a", MaxPayloadLength))}}}, ""},
+		{"long payload", models.Keyboard{Buttons: [][]models.Button{{Callback("Кнопка", "", strings.Repeat("a", MaxPayloadLength+1))}}}, "payload is 256 characters long, at most 255 are allowed"},
+		{"colors", models.Keyboard{Buttons: [][]models.Button{{Text("1", ColorPrimary, ""), Text("2", ColorSecondary, ""), Callback("3", ColorNegative, ""), Callback("4", ColorPositive, "")}}}, ""},
+		{"unknown color", models.Keyboard{Buttons: [][]models.Button{{Text("Кнопка", "red", "")}}}, `unknown color "red"`},
+		{"color on open_link", models.Keyboard{Buttons: [][]models.Button{{coloredLink}}}, "only text and callback buttons can have a color"},
+		{"open_link without link", models.Keyboard{Buttons: [][]models.Button{{OpenLink("Google", "", "")}}}, "link is empty"},
+		{"location", models.Keyboard{Buttons: [][]models.Button{{Location("")}, {Text("Кнопка", "", "")}}}, ""},
+		{"location sharing a row", models.Keyboard{Buttons: [][]models.Button{{Location(""), Text("Кнопка", "", "")}}}, "location button in row 1 must be the only button in its row"},
+		{"location with a label", models.Keyboard{Buttons: [][]models.Button{{newButton(TypeLocation, "Где я", "", "")}}}, "button can't have a label"},
+		{"vkpay", models.Keyboard{Buttons: [][]models.Button{{VKPay("action=pay-to-group&amount=100&group_id=1", "")}}}, ""},
+		{"vkpay sharing a row", models.Keyboard{Buttons: [][]models.Button{{Text("Кнопка", "", ""), VKPay("action=transfer-to-group&group_id=1", "")}}}, "vkpay button in row 1 must be the only button in its row"},
+		{"vkpay with a label", models.Keyboard{Buttons: [][]models.Button{{labeledVKPay}}}, "button can't have a label"},
+		{"vkpay without hash", models.Keyboard{Buttons: [][]models.Button{{VKPay("", "")}}}, "hash with the payment parameters is empty"},
+		{"open_app", models.Keyboard{Buttons: [][]models.Button{{OpenApp("Приложение", 1, 0, "", "")}}}, ""},
+		{"open_app without app", models.Keyboard{Buttons: [][]models.Button{{OpenApp("Приложение", 0, 0, "", "")}}}, "app ID is empty"},
+		{"intent", models.Keyboard{Inline: true, Buttons: [][]models.Button{{IntentSubscribe("Подписаться", 1, IntentConfirmedNotification, 0)}}}, ""},
+		{"unknown intent", models.Keyboard{Inline: true, Buttons: [][]models.Button{{IntentUnsubscribe("Отписаться", 1, "spam", 0)}}}, `unknown intent "spam"`},
+		{"unknown type", models.Keyboard{Buttons: [][]models.Button{{newButton("menu", "Меню", "", "")}}}, `unknown button type "menu"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.keyboard)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate returned %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Validate returned %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	keyboard, err := New().OneTime().
+		Row(Text("Погода", ColorPrimary, `{"cmd":"weather"}`), Callback("Котик", "", "")).
+		Row(Location("")).
+		Build()
+	if err != nil {
+		t.Fatalf("Build returned an error: %v", err)
+	}
+	if !keyboard.OneTime || keyboard.Inline || len(keyboard.Buttons) != 2 || len(keyboard.Buttons[0]) != 2 {
+		t.Errorf("Build returned %+v, want a one-time keyboard with two rows", keyboard)
+	}
+
+	keyboard, err = NewInline().OneTime().Row(Text("Погода", "", "")).Build()
+	if err == nil {
+		t.Errorf("Build of an inline one-time keyboard returned %+v, want an error", keyboard)
+	}
+	if len(keyboard.Buttons) != 0 {
+		t.Errorf("Build returned the keyboard %+v along with the error, want an empty one", keyboard)
+	}
+}
@@ -0,0 +1,243 @@
+package models
+
+import "encoding/json"
+
+// Attachment is a media object attached to a message, a post or a comment.
+// The object is decoded into the type matching the attachment type, e.g. Photo for "photo":
+//
+//	for _, attachment := range message.Attachments {
+//		switch object := attachment.Object.(type) {
+//		case models.Photo:
+//			...
+//		case models.Document:
+//			...
+//		}
+//	}
+type Attachment struct {
+	Type string `json:"type"`
+	// RawObject is the attachment object as sent by VK.
+	RawObject json.RawMessage `json:"-"`
+	// Object is the decoded attachment object.
+	// It is nil if the attachment type is not supported or the object couldn't be decoded, RawObject is still set then.
+	Object interface{} `json:"-"`
+	// DecodeErr is the error decoding the object of a supported attachment type, Object is nil then.
+	DecodeErr error `json:"-"`
+}
+
+// attachmentObjects maps the attachment types to the functions decoding their objects.
+var attachmentObjects = map[string]func(data json.RawMessage) (interface{}, error){
+	"photo":         decodeObject[Photo],
+	"video":         decodeObject[Video],
+	"audio":         decodeObject[Audio],
+	"doc":           decodeObject[Document],
+	"link":          decodeObject[Link],
+	"sticker":       decodeObject[Sticker],
+	"audio_message": decodeObject[AudioMessage],
+	"wall":          decodeObject[WallPost],
+	"wall_reply":    decodeObject[WallComment],
+}
+
+// UnmarshalJSON decodes the attachment, VK sends the object in the field named after the attachment type,
+// e.g. {"type": "photo", "photo": {...}}.
+// Like with updates, an object that can't be decoded doesn't fail the attachment, the error is kept in DecodeErr.
+func (a *Attachment) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	*a = Attachment{}
+	if rawType, ok := fields["type"]; ok {
+		if err := json.Unmarshal(rawType, &a.Type); err != nil {
+			return err
+		}
+	}
+	a.RawObject = fields[a.Type]
+	if decode, ok := attachmentObjects[a.Type]; ok && len(a.RawObject) > 0 {
+		a.Object, a.DecodeErr = decode(a.RawObject)
+	}
+	return nil
+}
+
+// Photos returns the photos attached to the message.
+func (m Message) Photos() []Photo {
+	photos := []Photo{}
+	for _, attachment := range m.Attachments {
+		if photo, ok := attachment.Object.(Photo); ok {
+			photos = append(photos, photo)
+		}
+	}
+	return photos
+}
+
+// Documents returns the documents attached to the message.
+func (m Message) Documents() []Document {
+	documents := []Document{}
+	for _, attachment := range m.Attachments {
+		if document, ok := attachment.Object.(Document); ok {
+			documents = append(documents, document)
+		}
+	}
+	return documents
+}
+
+// Links returns the links attached to the message.
+func (m Message) Links() []Link {
+	links := []Link{}
+	for _, attachment := range m.Attachments {
+		if link, ok := attachment.Object.(Link); ok {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// Sticker returns the sticker sent in the message, a sticker is always the only attachment of a message.
+func (m Message) Sticker() (Sticker, bool) {
+	for _, attachment := range m.Attachments {
+		if sticker, ok := attachment.Object.(Sticker); ok {
+			return sticker, true
+		}
+	}
+	return Sticker{}, false
+}
+
+// AudioMessage returns the voice message, a voice message is always the only attachment of a message.
+func (m Message) AudioMessage() (AudioMessage, bool) {
+	for _, attachment := range m.Attachments {
+		if audioMessage, ok := attachment.Object.(AudioMessage); ok {
+			return audioMessage, true
+		}
+	}
+	return AudioMessage{}, false
+}
+
+// Geo returns the location shared in the message.
+// VK sends it in the geo field of the message rather than as an attachment.
+func (m Message) Geo() (Geo, bool) {
+	if m.Location == nil {
+		return Geo{}, false
+	}
+	return *m.Location, true
+}
+
+// PhotoSize struct that represents a copy of a photo scaled to one of the sizes provided by VK
+type PhotoSize struct {
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Photo struct that represents the "photo" attachment
+type Photo struct {
+	ID        int         `json:"id"`
+	AlbumID   int         `json:"album_id"`
+	OwnerID   int         `json:"owner_id"`
+	UserID    int         `json:"user_id"`
+	Text      string      `json:"text"`
+	Date      int         `json:"date"`
+	Sizes     []PhotoSize `json:"sizes"`
+	AccessKey string      `json:"access_key,omitempty"`
+}
+
+// Largest returns the biggest copy of the photo, or an empty PhotoSize if VK sent no sizes.
+func (p Photo) Largest() PhotoSize {
+	largest := PhotoSize{}
+	for _, size := range p.Sizes {
+		if size.Width*size.Height > largest.Width*largest.Height {
+			largest = size
+		}
+	}
+	// sizes of old photos may come without dimensions, VK lists them from the smallest to the biggest one
+	if largest.URL == "" && len(p.Sizes) > 0 {
+		largest = p.Sizes[len(p.Sizes)-1]
+	}
+	return largest
+}
+
+// Video struct that represents the "video" attachment
+type Video struct {
+	ID          int    `json:"id"`
+	OwnerID     int    `json:"owner_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Duration    int    `json:"duration"`
+	Date        int    `json:"date"`
+	AccessKey   string `json:"access_key,omitempty"`
+}
+
+// Audio struct that represents the "audio" attachment
+type Audio struct {
+	ID       int    `json:"id"`
+	OwnerID  int    `json:"owner_id"`
+	Artist   string `json:"artist"`
+	Title    string `json:"title"`
+	Duration int    `json:"duration"`
+	URL      string `json:"url"`
+}
+
+// Document struct that represents the "doc" attachment
+type Document struct {
+	ID        int    `json:"id"`
+	OwnerID   int    `json:"owner_id"`
+	Title     string `json:"title"`
+	Size      int    `json:"size"`
+	Ext       string `json:"ext"`
+	URL       string `json:"url"`
+	Date      int    `json:"date"`
+	Type      int    `json:"type"`
+	AccessKey string `json:"access_key,omitempty"`
+}
+
+// Link struct that represents the "link" attachment
+type Link struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Caption     string `json:"caption"`
+	Description string `json:"description"`
+	Photo       *Photo `json:"photo,omitempty"`
+}
+
+// StickerImage struct that represents an image of a sticker in one of the sizes provided by VK
+type StickerImage struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Sticker struct that represents the "sticker" attachment
+type Sticker struct {
+	ProductID            int            `json:"product_id"`
+	StickerID            int            `json:"sticker_id"`
+	Images               []StickerImage `json:"images"`
+	ImagesWithBackground []StickerImage `json:"images_with_background"`
+}
+
+// AudioMessage struct that represents the "audio_message" attachment, a voice message
+type AudioMessage struct {
+	ID              int    `json:"id"`
+	OwnerID         int    `json:"owner_id"`
+	Duration        int    `json:"duration"`
+	Waveform        []int  `json:"waveform"`
+	LinkOgg         string `json:"link_ogg"`
+	LinkMp3         string `json:"link_mp3"`
+	AccessKey       string `json:"access_key,omitempty"`
+	TranscriptState string `json:"transcript_state,omitempty"`
+	Transcript      string `json:"transcript,omitempty"`
+}
+
+// Geo struct that represents a location shared in a message
+type Geo struct {
+	Type        string `json:"type"`
+	Coordinates struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"coordinates"`
+	Place *struct {
+		ID      int    `json:"id"`
+		Title   string `json:"title"`
+		Country string `json:"country"`
+		City    string `json:"city"`
+	} `json:"place,omitempty"`
+}
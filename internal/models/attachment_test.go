@@ -0,0 +1,154 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// message is a message with attachments as sent by VK
+const message = `{
+	"date":1700000000,"from_id":2,"id":5,"peer_id":2,"text":"",
+	"attachments":[
+		{"type":"photo","photo":{"album_id":-3,"date":1700000000,"id":457239017,"owner_id":2,"access_key":"a1b2",
+			"sizes":[
+				{"height":75,"type":"s","width":56,"url":"https://sun9-1.userapi.com/s.jpg"},
+				{"height":1280,"type":"w","width":960,"url":"https://sun9-1.userapi.com/w.jpg"},
+				{"height":604,"type":"x","width":453,"url":"https://sun9-1.userapi.com/x.jpg"}
+			],"text":""}},
+		{"type":"doc","doc":{"id":672039981,"owner_id":2,"title":"menu.pdf","size":48213,"ext":"pdf",
+			"url":"https://vk.com/doc2_672039981","date":1700000000,"type":1,"access_key":"c3d4"}},
+		{"type":"audio_message","audio_message":{"duration":3,"waveform":[0,4,12,31,15,2],"id":672039982,"owner_id":2,
+			"link_ogg":"https://psv4.userapi.com/a.ogg","link_mp3":"https://psv4.userapi.com/a.mp3","access_key":"e5f6"}},
+		{"type":"poll","poll":{"id":1,"question":"Пицца?"}},
+		{"type":"photo","photo":{"id":"457239018","sizes":"none"}}
+	],
+	"geo":{"type":"point","coordinates":{"latitude":55.7558,"longitude":37.6173},
+		"place":{"id":1,"title":"Москва, Россия","country":"Россия","city":"Москва"}}
+}`
+
+func TestDecodeAttachments(t *testing.T) {
+	decoded := Message{}
+	if err := json.Unmarshal([]byte(message), &decoded); err != nil {
+		t.Fatalf("error unmarshalling the message: %v", err)
+	}
+	if len(decoded.Attachments) != 5 {
+		t.Fatalf("got %d attachments, want 5", len(decoded.Attachments))
+	}
+
+	tests := []struct {
+		name     string
+		wantType string
+		want     interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "photo",
+			wantType: "photo",
+			want: Photo{ID: 457239017, AlbumID: -3, OwnerID: 2, Date: 1700000000, AccessKey: "a1b2", Sizes: []PhotoSize{
+				{Type: "s", URL: "https://sun9-1.userapi.com/s.jpg", Width: 56, Height: 75},
+				{Type: "w", URL: "https://sun9-1.userapi.com/w.jpg", Width: 960, Height: 1280},
+				{Type: "x", URL: "https://sun9-1.userapi.com/x.jpg", Width: 453, Height: 604},
+			}},
+		},
+		{
+			name:     "document",
+			wantType: "doc",
+			want: Document{ID: 672039981, OwnerID: 2, Title: "menu.pdf", Size: 48213, Ext: "pdf",
+				URL: "https://vk.com/doc2_672039981", Date: 1700000000, Type: 1, AccessKey: "c3d4"},
+		},
+		{
+			name:     "audio message",
+			wantType: "audio_message",
+			want: AudioMessage{ID: 672039982, OwnerID: 2, Duration: 3, Waveform: []int{0, 4, 12, 31, 15, 2},
+				LinkOgg: "https://psv4.userapi.com/a.ogg", LinkMp3: "https://psv4.userapi.com/a.mp3", AccessKey: "e5f6"},
+		},
+		{
+			name:     "unknown type",
+			wantType: "poll",
+		},
+		{
+			name:     "malformed object",
+			wantType: "photo",
+			wantErr:  true,
+		},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attachment := decoded.Attachments[i]
+			if attachment.Type != test.wantType {
+				t.Errorf("got type %q, want %q", attachment.Type, test.wantType)
+			}
+			if !reflect.DeepEqual(attachment.Object, test.want) {
+				t.Errorf("got object %#v, want %#v", attachment.Object, test.want)
+			}
+			if (attachment.DecodeErr != nil) != test.wantErr {
+				t.Errorf("got decode error %v, want error: %v", attachment.DecodeErr, test.wantErr)
+			}
+			if len(attachment.RawObject) == 0 {
+				t.Errorf("raw object is empty, want it kept as sent by VK")
+			}
+		})
+	}
+
+	// the helpers skip the attachments of other types and the ones that couldn't be decoded
+	if photos := decoded.Photos(); len(photos) != 1 || photos[0].ID != 457239017 {
+		t.Errorf("Photos() = %+v, want the decoded photo", photos)
+	}
+	if documents := decoded.Documents(); len(documents) != 1 || documents[0].Title != "menu.pdf" {
+		t.Errorf("Documents() = %+v, want the document", documents)
+	}
+	if audioMessage, ok := decoded.AudioMessage(); !ok || audioMessage.LinkMp3 != "https://psv4.userapi.com/a.mp3" {
+		t.Errorf("AudioMessage() = %+v, %v, want the voice message", audioMessage, ok)
+	}
+	if _, ok := decoded.Sticker(); ok {
+		t.Errorf("Sticker() returned a sticker for a message without one")
+	}
+	geo, ok := decoded.Geo()
+	if !ok || geo.Coordinates.Latitude != 55.7558 || geo.Coordinates.Longitude != 37.6173 || geo.Place == nil || geo.Place.City != "Москва" {
+		t.Errorf("Geo() = %+v, %v, want the location in Moscow", geo, ok)
+	}
+	if _, ok := (Message{}).Geo(); ok {
+		t.Errorf("Geo() returned a location for a message without one")
+	}
+}
+
+func TestPhotoLargest(t *testing.T) {
+	tests := []struct {
+		name  string
+		sizes string
+		want  string
+	}{
+		{
+			name:  "biggest by dimensions",
+			sizes: `[{"type":"s","url":"s.jpg","width":56,"height":75},{"type":"w","url":"w.jpg","width":960,"height":1280},{"type":"x","url":"x.jpg","width":453,"height":604}]`,
+			want:  "w.jpg",
+		},
+		{
+			// old photos come with the sizes listed from the smallest to the biggest one and no dimensions
+			name:  "sizes without dimensions",
+			sizes: `[{"type":"s","url":"s.jpg","width":0,"height":0},{"type":"m","url":"m.jpg","width":0,"height":0},{"type":"x","url":"x.jpg","width":0,"height":0}]`,
+			want:  "x.jpg",
+		},
+		{
+			name:  "no sizes",
+			sizes: `[]`,
+			want:  "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attachment := Attachment{}
+			if err := json.Unmarshal([]byte(`{"type":"photo","photo":{"id":1,"owner_id":2,"sizes":`+test.sizes+`}}`), &attachment); err != nil {
+				t.Fatalf("error unmarshalling the attachment: %v", err)
+			}
+			photo, ok := attachment.Object.(Photo)
+			if !ok {
+				t.Fatalf("got object %#v, want a Photo", attachment.Object)
+			}
+			if got := photo.Largest().URL; got != test.want {
+				t.Errorf("Largest().URL = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -1,61 +1,73 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Longpoll server response
 type ServerResponse struct {
-	Ts      string `json:"ts"`
-	Updates []struct {
-		GroupID int    `json:"group_id"`
-		Type    string `json:"type"`
-		EventID string `json:"event_id"`
-		V       string `json:"v"`
-		Object  struct {
-			Message struct {
-				Date                  int           `json:"date"`
-				FromID                int           `json:"from_id"`
-				ID                    int           `json:"id"`
-				Out                   int           `json:"out"`
-				Attachments           []interface{} `json:"attachments"`
-				ConversationMessageID int           `json:"conversation_message_id"`
-				FwdMessages           []interface{} `json:"fwd_messages"`
-				Important             bool          `json:"important"`
-				IsHidden              bool          `json:"is_hidden"`
-				PeerID                int           `json:"peer_id"`
-				RandomID              int           `json:"random_id"`
-				Text                  string        `json:"text"`
-			} `json:"message"`
-			ClientInfo struct {
-				ButtonActions  []string `json:"button_actions"`
-				Keyboard       bool     `json:"keyboard"`
-				InlineKeyboard bool     `json:"inline_keyboard"`
-				Carousel       bool     `json:"carousel"`
-				LangID         int      `json:"lang_id"`
-			} `json:"client_info"`
-			Payload struct {
-				Button string `json:"button"`
-			} `json:"payload"`
-			PeerID                int    `json:"peer_id"`
-			ConversationMessageID int    `json:"conversation_message_id"`
-			EventID               string `json:"event_id"`
-		} `json:"object"`
-	} `json:"updates"`
-	Failed int `json:"failed,omitempty"`
+	Ts      Timestamp `json:"ts"`
+	Updates []Update  `json:"updates"`
+	Failed  int       `json:"failed,omitempty"`
+	// Done is called by the receiver once every update of the response has been handled, so the transport
+	// knows the updates don't have to be delivered again. It is nil if the transport doesn't need to know.
+	Done func() `json:"-"`
+}
+
+// Timestamp is the ts value of the LongPollServer.
+// VK sends it as a string in regular responses but may send a number along with "failed":1, so both are accepted.
+type Timestamp string
+
+// UnmarshalJSON decodes the timestamp from either a JSON string or a JSON number.
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*t = Timestamp(text)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*t = Timestamp(number)
+	return nil
+}
+
+// Forward struct that is being sent in the forward parameter of messages.send
+// to forward or quote messages of a conversation
+type Forward struct {
+	OwnerID                int   `json:"owner_id,omitempty"`
+	PeerID                 int   `json:"peer_id"`
+	ConversationMessageIDs []int `json:"conversation_message_ids,omitempty"`
+	MessageIDs             []int `json:"message_ids,omitempty"`
+	IsReply                bool  `json:"is_reply,omitempty"`
 }
 
 // Keyboard struct that is being sent with message
 type Keyboard struct {
+	OneTime bool       `json:"one_time,omitempty"`
 	Inline  bool       `json:"inline,omitempty"`
-	Buttons [][]Button `json:"buttons,omitempty"`
+	Buttons [][]Button `json:"buttons"`
 }
 
-// Button struct that is being sent with Keyboard
+// Button struct that is being sent with Keyboard.
+// Every button type uses its own set of the action fields:
+// text and callback use Label, open_link uses Link and Label, location uses no other fields,
+// vkpay uses Hash, open_app uses AppID, OwnerID, Hash and Label,
+// intent_subscribe and intent_unsubscribe use PeerID, Intent, SubscribeID and Label.
 type Button struct {
 	Action struct {
-		Type    string `json:"type"`
-		Link    string `json:"link,omitempty"`
-		Label   string `json:"label"`
-		Payload string `json:"payload,omitempty"`
+		Type        string `json:"type"`
+		Link        string `json:"link,omitempty"`
+		Label       string `json:"label,omitempty"`
+		Payload     string `json:"payload,omitempty"`
+		Hash        string `json:"hash,omitempty"`
+		AppID       int    `json:"app_id,omitempty"`
+		OwnerID     int    `json:"owner_id,omitempty"`
+		PeerID      int    `json:"peer_id,omitempty"`
+		Intent      string `json:"intent,omitempty"`
+		SubscribeID int    `json:"subscribe_id,omitempty"`
 	} `json:"action"`
 	Color string `json:"color,omitempty"`
 }
@@ -106,3 +118,54 @@ type EventAnswer struct {
 	Type string `json:"type"`
 	Text string `json:"text"`
 }
+
+// UploadServer struct that represents the response of the methods returning an upload address
+type UploadServer struct {
+	UploadURL string `json:"upload_url"`
+	AlbumID   int    `json:"album_id,omitempty"`
+	UserID    int    `json:"user_id,omitempty"`
+	GroupID   int    `json:"group_id,omitempty"`
+}
+
+// PhotoUpload struct that represents the response of the upload server after a photo is uploaded
+type PhotoUpload struct {
+	Server int    `json:"server"`
+	Photo  string `json:"photo"`
+	Hash   string `json:"hash"`
+}
+
+// SavedPhoto struct that represents a photo saved with photos.saveMessagesPhoto
+type SavedPhoto struct {
+	ID        int    `json:"id"`
+	OwnerID   int    `json:"owner_id"`
+	AccessKey string `json:"access_key,omitempty"`
+}
+
+// DocumentUpload struct that represents the response of the upload server after a document is uploaded
+type DocumentUpload struct {
+	File  string `json:"file"`
+	Error string `json:"error,omitempty"`
+}
+
+// SavedDocument struct that represents a document saved with docs.save
+type SavedDocument struct {
+	Type string `json:"type"`
+	Doc  struct {
+		ID        int    `json:"id"`
+		OwnerID   int    `json:"owner_id"`
+		Title     string `json:"title"`
+		URL       string `json:"url"`
+		AccessKey string `json:"access_key,omitempty"`
+	} `json:"doc"`
+}
+
+// SentMessage struct that represents a message sent with messages.send using the peer_ids parameter
+type SentMessage struct {
+	PeerID                int `json:"peer_id"`
+	MessageID             int `json:"message_id"`
+	ConversationMessageID int `json:"conversation_message_id"`
+	Error                 *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error,omitempty"`
+}
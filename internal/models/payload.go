@@ -0,0 +1,80 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// Payload is the payload of a button pressed by the user, a JSON value set by the bot when it sent the keyboard.
+// Callback buttons deliver it as is in the message_event update, while text buttons deliver it
+// as a JSON encoded string in the payload field of the message, both are decoded into the same JSON value.
+type Payload json.RawMessage
+
+// UnmarshalJSON stores the payload, unwrapping the JSON value of text buttons from the string it is sent in.
+// A string that doesn't hold a JSON value, e.g. the payload of a button of another bot, is kept as a JSON string,
+// so the payload always stays valid JSON.
+func (p *Payload) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*p = nil
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		if json.Valid([]byte(text)) {
+			*p = Payload(text)
+			return nil
+		}
+	}
+	*p = append((*p)[:0], data...)
+	return nil
+}
+
+// MarshalJSON returns the payload as is, or null if it is empty.
+func (p Payload) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+// Decode unmarshals the payload into v, which should be a pointer to a struct matching the payload.
+func (p Payload) Decode(v interface{}) error {
+	if len(p) == 0 {
+		return errors.New("payload is empty")
+	}
+	return json.Unmarshal(p, v)
+}
+
+// Command decodes the payload following the Command schema.
+// It returns false if the payload is empty, isn't a JSON object or has no "cmd" field,
+// e.g. for buttons created without a payload or by other bots.
+func (p Payload) Command() (Command, bool) {
+	command := Command{}
+	if err := p.Decode(&command); err != nil || command.Cmd == "" {
+		return Command{}, false
+	}
+	return command, true
+}
+
+// Command is the schema of the payloads of the bot's buttons:
+// the name of the command and its arguments, e.g. {"cmd": "weather", "args": {"city": "London"}}.
+type Command struct {
+	Cmd  string            `json:"cmd"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// Payload returns the command encoded as a button payload.
+func (c Command) Payload() string {
+	// the struct has only strings, marshaling it can't fail
+	encoded, _ := json.Marshal(c)
+	return string(encoded)
+}
+
+// Arg returns the argument of the command with the given name, or an empty string if there is none.
+func (c Command) Arg(name string) string {
+	return c.Args[name]
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPayloadCommand(t *testing.T) {
+	want := Command{Cmd: "weather", Args: map[string]string{"city": "Москва"}}
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"text button", `{"peer_id":1,"text":"Погода","payload":"{\"cmd\":\"weather\",\"args\":{\"city\":\"Москва\"}}"}`},
+		{"callback button", `{"peer_id":1,"payload":{"cmd":"weather","args":{"city":"Москва"}}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := Message{}
+			if err := json.Unmarshal([]byte(test.data), &message); err != nil {
+				t.Fatalf("error unmarshalling the message: %v", err)
+			}
+			got, ok := message.Payload.Command()
+			if !ok || !reflect.DeepEqual(got, want) {
+				t.Errorf("Command() = %+v, %v, want %+v, true", got, ok, want)
+			}
+		})
+	}
+}
+
+func TestPayloadUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		want        string
+		wantCommand bool
+	}{
+		{"object", `{"cmd":"cat"}`, `{"cmd":"cat"}`, true},
+		{"object in a string", `"{\"cmd\":\"cat\"}"`, `{"cmd":"cat"}`, true},
+		{"number in a string", `"1"`, `1`, false},
+		{"plain string", `"hello"`, `"hello"`, false},
+		{"empty string", `""`, `""`, false},
+		{"object without cmd", `{"button":"1"}`, `{"button":"1"}`, false},
+		{"null", `null`, ``, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := Payload{}
+			if err := json.Unmarshal([]byte(test.data), &payload); err != nil {
+				t.Fatalf("error unmarshalling the payload: %v", err)
+			}
+			if string(payload) != test.want {
+				t.Errorf("got payload %s, want %s", payload, test.want)
+			}
+			if _, ok := payload.Command(); ok != test.wantCommand {
+				t.Errorf("Command() returned %v, want %v", ok, test.wantCommand)
+			}
+		})
+	}
+}
+
+func TestPayloadMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"text button", `{"peer_id":1,"payload":"{\"cmd\":\"cat\"}"}`, `"payload":{"cmd":"cat"}`},
+		{"plain string", `{"peer_id":1,"payload":"hello"}`, `"payload":"hello"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := Message{}
+			if err := json.Unmarshal([]byte(test.data), &message); err != nil {
+				t.Fatalf("error unmarshalling the message: %v", err)
+			}
+			encoded, err := json.Marshal(message)
+			if err != nil {
+				t.Fatalf("error marshaling the message: %v", err)
+			}
+			if !json.Valid(encoded) || !strings.Contains(string(encoded), test.want) {
+				t.Errorf("got %s, want it to contain %s", encoded, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package models
+
+import "encoding/json"
+
+// Update is a single event delivered by the LongPollServer or the Callback API.
+// The object of the event is decoded into the type matching the update type, e.g. MessageNew for "message_new",
+// so handlers can switch on the type of Object:
+//
+//	switch event := update.Object.(type) {
+//	case models.MessageNew:
+//		...
+//	case models.MessageEvent:
+//		...
+//	}
+type Update struct {
+	GroupID int    `json:"group_id"`
+	Type    string `json:"type"`
+	EventID string `json:"event_id"`
+	V       string `json:"v"`
+	// RawObject is the object of the event as sent by VK.
+	RawObject json.RawMessage `json:"object"`
+	// Object is the decoded object of the event.
+	// It is nil if the update type is not supported or the object couldn't be decoded, RawObject is still set then.
+	Object interface{} `json:"-"`
+	// DecodeErr is the error decoding the object of a supported update type, Object is nil then.
+	DecodeErr error `json:"-"`
+}
+
+// updateObjects maps the update types to the functions decoding their objects.
+var updateObjects = map[string]func(data json.RawMessage) (interface{}, error){
+	"message_new":          decodeObject[MessageNew],
+	"message_reply":        decodeObject[MessageReply],
+	"message_edit":         decodeObject[MessageEdit],
+	"message_event":        decodeObject[MessageEvent],
+	"message_allow":        decodeObject[MessageAllow],
+	"message_deny":         decodeObject[MessageDeny],
+	"message_typing_state": decodeObject[MessageTypingState],
+	"group_join":           decodeObject[GroupJoin],
+	"group_leave":          decodeObject[GroupLeave],
+	"user_block":           decodeObject[UserBlock],
+	"user_unblock":         decodeObject[UserUnblock],
+	"wall_post_new":        decodeObject[WallPostNew],
+	"wall_repost":          decodeObject[WallRepost],
+	"wall_reply_new":       decodeObject[WallReplyNew],
+	"wall_reply_edit":      decodeObject[WallReplyEdit],
+	"wall_reply_restore":   decodeObject[WallReplyRestore],
+	"wall_reply_delete":    decodeObject[WallReplyDelete],
+	"like_add":             decodeObject[LikeAdd],
+	"like_remove":          decodeObject[LikeRemove],
+	"vkpay_transaction":    decodeObject[VKPayTransaction],
+	"app_payload":          decodeObject[AppPayload],
+}
+
+// decodeObject unmarshals the object of an update or an attachment into a value of type T.
+func decodeObject[T any](data json.RawMessage) (interface{}, error) {
+	var object T
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// UnmarshalJSON decodes the update and its object.
+// An object that can't be decoded doesn't fail the update, so one malformed event
+// doesn't make the bot drop the other events delivered along with it, the error is kept in DecodeErr instead.
+func (u *Update) UnmarshalJSON(data []byte) error {
+	type rawUpdate Update
+	raw := rawUpdate{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*u = Update(raw)
+	if decode, ok := updateObjects[u.Type]; ok && len(u.RawObject) > 0 {
+		u.Object, u.DecodeErr = decode(u.RawObject)
+	}
+	return nil
+}
+
+// PeerID returns the ID of the conversation the update belongs to, or 0 if it isn't related to a conversation.
+func (u Update) PeerID() int {
+	switch object := u.Object.(type) {
+	case MessageNew:
+		return object.Message.PeerID
+	case MessageReply:
+		return object.PeerID
+	case MessageEdit:
+		return object.PeerID
+	case MessageEvent:
+		return object.PeerID
+	case MessageAllow:
+		return object.UserID
+	case MessageDeny:
+		return object.UserID
+	case MessageTypingState:
+		return object.FromID
+	case VKPayTransaction:
+		return object.FromID
+	case AppPayload:
+		return object.UserID
+	}
+	return 0
+}
+
+// ChatPeerIDOffset is added to the ID of a group chat to get its peer ID
+const ChatPeerIDOffset = 2000000000
+
+// Message struct that represents a private message or a message in a group chat
+type Message struct {
+	Date                  int          `json:"date"`
+	FromID                int          `json:"from_id"`
+	ID                    int          `json:"id"`
+	Out                   int          `json:"out"`
+	Attachments           []Attachment `json:"attachments"`
+	ConversationMessageID int          `json:"conversation_message_id"`
+	FwdMessages           []Message    `json:"fwd_messages"`
+	ReplyMessage          *Message     `json:"reply_message,omitempty"`
+	Important             bool         `json:"important"`
+	IsHidden              bool         `json:"is_hidden"`
+	PeerID                int          `json:"peer_id"`
+	RandomID              int          `json:"random_id"`
+	Text                  string       `json:"text"`
+	Location              *Geo         `json:"geo,omitempty"`
+	// Payload is set if the message was sent by pressing a text button with a payload
+	Payload Payload `json:"payload,omitempty"`
+}
+
+// IsChat reports whether the message was sent to a group chat rather than private messages.
+func (m Message) IsChat() bool {
+	return m.PeerID > ChatPeerIDOffset
+}
+
+// ClientInfo struct that describes the features supported by the client of the user who sent a message
+type ClientInfo struct {
+	ButtonActions  []string `json:"button_actions"`
+	Keyboard       bool     `json:"keyboard"`
+	InlineKeyboard bool     `json:"inline_keyboard"`
+	Carousel       bool     `json:"carousel"`
+	LangID         int      `json:"lang_id"`
+}
+
+// MessageNew is the object of the "message_new" update, sent when the group receives a message
+type MessageNew struct {
+	Message    Message    `json:"message"`
+	ClientInfo ClientInfo `json:"client_info"`
+}
+
+// MessageReply is the object of the "message_reply" update, sent when the group sends a message
+type MessageReply struct {
+	Message
+}
+
+// MessageEdit is the object of the "message_edit" update, sent when a message of the group is edited
+type MessageEdit struct {
+	Message
+}
+
+// MessageEvent is the object of the "message_event" update, sent when a user presses a callback button
+type MessageEvent struct {
+	UserID                int     `json:"user_id"`
+	PeerID                int     `json:"peer_id"`
+	Payload               Payload `json:"payload"`
+	ConversationMessageID int     `json:"conversation_message_id"`
+	EventID               string  `json:"event_id"`
+}
+
+// MessageAllow is the object of the "message_allow" update, sent when a user allows messages from the group
+type MessageAllow struct {
+	UserID int    `json:"user_id"`
+	Key    string `json:"key"`
+}
+
+// MessageDeny is the object of the "message_deny" update, sent when a user denies messages from the group
+type MessageDeny struct {
+	UserID int `json:"user_id"`
+}
+
+// MessageTypingState is the object of the "message_typing_state" update, sent when a user starts typing
+type MessageTypingState struct {
+	State  string `json:"state"`
+	FromID int    `json:"from_id"`
+	ToID   int    `json:"to_id"`
+}
+
+// GroupJoin is the object of the "group_join" update, sent when a user joins the group
+type GroupJoin struct {
+	UserID   int    `json:"user_id"`
+	JoinType string `json:"join_type"`
+}
+
+// GroupLeave is the object of the "group_leave" update, sent when a user leaves the group or is removed from it
+type GroupLeave struct {
+	UserID int `json:"user_id"`
+	// Self is 1 if the user left the group and 0 if they were removed
+	Self int `json:"self"`
+}
+
+// UserBlock is the object of the "user_block" update, sent when a user is added to the group's blacklist
+type UserBlock struct {
+	AdminID     int    `json:"admin_id"`
+	UserID      int    `json:"user_id"`
+	UnblockDate int    `json:"unblock_date"`
+	Reason      int    `json:"reason"`
+	Comment     string `json:"comment"`
+}
+
+// UserUnblock is the object of the "user_unblock" update, sent when a user is removed from the group's blacklist
+type UserUnblock struct {
+	AdminID int `json:"admin_id"`
+	UserID  int `json:"user_id"`
+	// ByEndDate is 1 if the user was unblocked because the block expired
+	ByEndDate int `json:"by_end_date"`
+}
+
+// WallPost struct that represents a post on a wall
+type WallPost struct {
+	ID           int          `json:"id"`
+	OwnerID      int          `json:"owner_id"`
+	FromID       int          `json:"from_id"`
+	CreatedBy    int          `json:"created_by"`
+	Date         int          `json:"date"`
+	Text         string       `json:"text"`
+	ReplyOwnerID int          `json:"reply_owner_id"`
+	ReplyPostID  int          `json:"reply_post_id"`
+	PostType     string       `json:"post_type"`
+	Attachments  []Attachment `json:"attachments"`
+}
+
+// WallPostNew is the object of the "wall_post_new" update, sent when a post is published on the group's wall
+type WallPostNew struct {
+	WallPost
+}
+
+// WallRepost is the object of the "wall_repost" update, sent when a post of the group is reposted
+type WallRepost struct {
+	WallPost
+}
+
+// WallComment struct that represents a comment to a post on a wall
+type WallComment struct {
+	ID             int          `json:"id"`
+	FromID         int          `json:"from_id"`
+	Date           int          `json:"date"`
+	Text           string       `json:"text"`
+	PostID         int          `json:"post_id"`
+	PostOwnerID    int          `json:"post_owner_id"`
+	ReplyToUser    int          `json:"reply_to_user"`
+	ReplyToComment int          `json:"reply_to_comment"`
+	ParentsStack   []int        `json:"parents_stack"`
+	Attachments    []Attachment `json:"attachments"`
+}
+
+// WallReplyNew is the object of the "wall_reply_new" update, sent when a comment is added to a post of the group
+type WallReplyNew struct {
+	WallComment
+}
+
+// WallReplyEdit is the object of the "wall_reply_edit" update, sent when a comment is edited
+type WallReplyEdit struct {
+	WallComment
+}
+
+// WallReplyRestore is the object of the "wall_reply_restore" update, sent when a deleted comment is restored
+type WallReplyRestore struct {
+	WallComment
+}
+
+// WallReplyDelete is the object of the "wall_reply_delete" update, sent when a comment is deleted
+type WallReplyDelete struct {
+	OwnerID   int `json:"owner_id"`
+	ID        int `json:"id"`
+	DeleterID int `json:"deleter_id"`
+	PostID    int `json:"post_id"`
+}
+
+// Like struct that represents a like of an object of the group
+type Like struct {
+	LikerID       int    `json:"liker_id"`
+	ObjectType    string `json:"object_type"`
+	ObjectOwnerID int    `json:"object_owner_id"`
+	ObjectID      int    `json:"object_id"`
+	ThreadReplyID int    `json:"thread_reply_id"`
+	PostID        int    `json:"post_id"`
+}
+
+// LikeAdd is the object of the "like_add" update, sent when a user likes an object of the group
+type LikeAdd struct {
+	Like
+}
+
+// LikeRemove is the object of the "like_remove" update, sent when a user removes a like
+type LikeRemove struct {
+	Like
+}
+
+// VKPayTransaction is the object of the "vkpay_transaction" update, sent when a user pays the group with VK Pay,
+// e.g. by pressing a vkpay button
+type VKPayTransaction struct {
+	FromID int `json:"from_id"`
+	// Amount is the amount of the payment in thousandths of a ruble
+	Amount      int    `json:"amount"`
+	Description string `json:"description"`
+	Date        int    `json:"date"`
+}
+
+// AppPayload is the object of the "app_payload" update, sent by a VK Mini App opened with an open_app button
+type AppPayload struct {
+	UserID  int     `json:"user_id"`
+	AppID   int     `json:"app_id"`
+	GroupID int     `json:"group_id"`
+	Payload Payload `json:"payload"`
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeUpdates(t *testing.T) {
+	batch := `{"ts":"10","updates":[
+		{"group_id":1,"type":"message_new","event_id":"e1","v":"5.131","object":{
+			"message":{"date":1700000000,"from_id":2,"id":5,"peer_id":2000000001,"text":"Погода","conversation_message_id":3,
+				"payload":"{\"cmd\":\"weather\"}"},
+			"client_info":{"button_actions":["text","callback"],"keyboard":true,"inline_keyboard":true,"lang_id":0}}},
+		{"group_id":1,"type":"message_event","event_id":"e2","v":"5.131","object":{
+			"user_id":2,"peer_id":2,"event_id":"abc","payload":{"cmd":"cat"},"conversation_message_id":7}},
+		{"group_id":1,"type":"group_leave","event_id":"e3","v":"5.131","object":{"user_id":2,"self":1}},
+		{"group_id":1,"type":"photo_new","event_id":"e4","v":"5.131","object":{"id":1}},
+		{"group_id":1,"type":"message_event","event_id":"e5","v":"5.131","object":{"user_id":"two"}}
+	]}`
+
+	response := ServerResponse{}
+	if err := json.Unmarshal([]byte(batch), &response); err != nil {
+		t.Fatalf("error unmarshalling the batch: %v", err)
+	}
+	if response.Ts != "10" || len(response.Updates) != 5 {
+		t.Fatalf("got ts %q and %d updates, want ts 10 and 5 updates", response.Ts, len(response.Updates))
+	}
+
+	tests := []struct {
+		name       string
+		want       interface{}
+		wantPeerID int
+		wantErr    bool
+	}{
+		{
+			name: "message_new",
+			want: MessageNew{
+				Message: Message{Date: 1700000000, FromID: 2, ID: 5, PeerID: 2000000001, Text: "Погода", ConversationMessageID: 3,
+					Payload: Payload(`{"cmd":"weather"}`)},
+				ClientInfo: ClientInfo{ButtonActions: []string{"text", "callback"}, Keyboard: true, InlineKeyboard: true},
+			},
+			wantPeerID: 2000000001,
+		},
+		{
+			name:       "message_event",
+			want:       MessageEvent{UserID: 2, PeerID: 2, EventID: "abc", Payload: Payload(`{"cmd":"cat"}`), ConversationMessageID: 7},
+			wantPeerID: 2,
+		},
+		{
+			name: "group_leave",
+			want: GroupLeave{UserID: 2, Self: 1},
+		},
+		{
+			name: "unknown type",
+		},
+		{
+			name:    "malformed object",
+			wantErr: true,
+		},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			update := response.Updates[i]
+			if !reflect.DeepEqual(update.Object, test.want) {
+				t.Errorf("got object %#v, want %#v", update.Object, test.want)
+			}
+			if (update.DecodeErr != nil) != test.wantErr {
+				t.Errorf("got decode error %v, want error: %v", update.DecodeErr, test.wantErr)
+			}
+			if len(update.RawObject) == 0 {
+				t.Errorf("raw object is empty, want it kept as sent by VK")
+			}
+			if got := update.PeerID(); got != test.wantPeerID {
+				t.Errorf("PeerID() = %d, want %d", got, test.wantPeerID)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"goVkBot/internal/retry"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket rate limiter.
+// The bucket holds up to burst tokens and is refilled at rate tokens per second,
+// every request takes one token and waits if there is none left.
+// A Limiter is safe for concurrent use and should be shared by everything using the same access token,
+// since VK counts requests per token.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// New creates a limiter with a full bucket.
+//
+// Parameters:
+//   - rate: The number of requests allowed per second on average.
+//   - burst: The number of requests allowed at once after a pause, values below 1 are treated as 1.
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait takes a token from the bucket, waiting until one is available or the context is done.
+// It returns the context error if the context was done before a token became available.
+// A nil limiter or a limiter with a non-positive rate never waits.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil || l.rate <= 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	// the token is reserved right away, so concurrent callers queue up behind each other
+	l.tokens--
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	if err := retry.Sleep(ctx, wait); err != nil {
+		// give the reserved token back, the request won't be made
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterBurstThenRate(t *testing.T) {
+	limiter := New(50, 3)
+
+	// the full bucket lets the burst through at once
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait returned %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*15 {
+		t.Errorf("burst took %v, want no waiting", elapsed)
+	}
+
+	// then every request waits for a new token, 20ms at 50 requests per second
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait returned %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*55 {
+		t.Errorf("3 requests after the burst took %v, want at least 60ms", elapsed)
+	}
+}
+
+func TestLimiterReturnsTokenOnCancel(t *testing.T) {
+	limiter := New(10, 1)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait returned %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait returned %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the cancelled request gave its token back, so the next one waits for a single token (100ms), not two
+	start := time.Now()
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait returned %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*150 {
+		t.Errorf("Wait after a cancelled request took %v, want at most 100ms", elapsed)
+	}
+}
+
+func TestLimiterNeverWaits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter *Limiter
+	}{
+		{"nil limiter", nil},
+		{"zero rate", New(0, 1)},
+		{"negative rate", New(-1, 1)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			for i := 0; i < 100; i++ {
+				if err := test.limiter.Wait(context.Background()); err != nil {
+					t.Fatalf("Wait returned %v", err)
+				}
+			}
+			if elapsed := time.Since(start); elapsed > time.Millisecond*50 {
+				t.Errorf("100 requests took %v, want no waiting", elapsed)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if err := test.limiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("Wait with a cancelled context returned %v, want %v", err, context.Canceled)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Policy describes how a failed operation is retried: the delay between attempts grows exponentially
+// from InitialDelay by Multiplier up to MaxDelay, and every delay is randomized by Jitter.
+//
+// The zero Policy behaves like DefaultPolicy, so a Bot without a configured policy still backs off between attempts.
+//
+// Fields:
+//   - InitialDelay: The delay before the first retry, zero or negative values use the delay of DefaultPolicy.
+//   - MaxDelay: The upper bound for a single delay, zero means no bound.
+//   - Multiplier: The factor the delay grows by after each attempt, values below 1 are treated as 1.
+//   - Jitter: The fraction of the delay that is randomized, e.g. 0.2 gives a delay within ±20%. Must be between 0 and 1.
+//   - MaxAttempts: The total number of attempts including the first one, values below 1 are treated as 1.
+type Policy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64
+	MaxAttempts  int
+}
+
+// DefaultPolicy returns the policy used when nothing else is configured.
+func DefaultPolicy() Policy {
+	return Policy{
+		InitialDelay: time.Millisecond * 500,
+		MaxDelay:     time.Second * 30,
+		Multiplier:   2,
+		Jitter:       0.2,
+		MaxAttempts:  5,
+	}
+}
+
+// permanentError marks an error that must not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps the error so Do returns it immediately instead of retrying.
+// Permanent(nil) returns nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// orDefault returns DefaultPolicy for the zero Policy and fills in the initial delay if it isn't set,
+// so the delays never drop to zero and turn a retry loop into a busy loop.
+func (p Policy) orDefault() Policy {
+	if p == (Policy{}) {
+		return DefaultPolicy()
+	}
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = DefaultPolicy().InitialDelay
+	}
+	return p
+}
+
+// Delay returns the pause before the given retry, where retry 1 is the first retry after the initial attempt.
+// The delay grows exponentially with every retry, is capped by MaxDelay and randomized by Jitter.
+func (p Policy) Delay(retry int) time.Duration {
+	p = p.orDefault()
+	if retry < 1 {
+		retry = 1
+	}
+	multiplier := math.Max(p.Multiplier, 1)
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay += delay * jitter * (2*rand.Float64() - 1)
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	return time.Duration(delay)
+}
+
+// Do calls fn until it succeeds, returns a Permanent error, the attempts are exhausted or the context is cancelled.
+// It returns nil on success, otherwise the last error returned by fn, unwrapped from Permanent.
+// If the context is cancelled while waiting, the context error is returned.
+func (p Policy) Do(ctx context.Context, fn func() error) error {
+	p = p.orDefault()
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if attempt >= attempts {
+			return err
+		}
+		if sleepErr := Sleep(ctx, p.Delay(attempt)); sleepErr != nil {
+			return sleepErr
+		}
+	}
+}
+
+// Sleep pauses for the given duration or until the context is cancelled, whichever comes first.
+// It returns the context error if the context was cancelled.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,148 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		retry  int
+		want   time.Duration
+	}{
+		{"first retry", Policy{InitialDelay: time.Second, Multiplier: 2}, 1, time.Second},
+		{"retry below 1", Policy{InitialDelay: time.Second, Multiplier: 2}, 0, time.Second},
+		{"exponential growth", Policy{InitialDelay: time.Second, Multiplier: 2}, 4, time.Second * 8},
+		{"multiplier below 1", Policy{InitialDelay: time.Second, Multiplier: 0.5}, 3, time.Second},
+		{"capped by max delay", Policy{InitialDelay: time.Second, MaxDelay: time.Second * 5, Multiplier: 2}, 10, time.Second * 5},
+		{"no cap without max delay", Policy{InitialDelay: time.Second, Multiplier: 2}, 10, time.Second * 512},
+		{"zero initial delay", Policy{Multiplier: 2, MaxAttempts: 3}, 2, DefaultPolicy().InitialDelay * 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.Delay(test.retry); got != test.want {
+				t.Errorf("Delay(%d) = %v, want %v", test.retry, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyDelayZeroPolicy(t *testing.T) {
+	policy := Policy{}
+	defaults := DefaultPolicy()
+	for retry := 1; retry <= 10; retry++ {
+		got := policy.Delay(retry)
+		if got <= 0 {
+			t.Fatalf("Delay(%d) of the zero policy = %v, want a positive delay", retry, got)
+		}
+		if got > defaults.MaxDelay {
+			t.Errorf("Delay(%d) of the zero policy = %v, want at most %v", retry, got, defaults.MaxDelay)
+		}
+	}
+}
+
+func TestPolicyDelayJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		retry    int
+		min, max time.Duration
+	}{
+		{"within jitter", Policy{InitialDelay: time.Second, Multiplier: 2, Jitter: 0.2}, 2, time.Millisecond * 1600, time.Millisecond * 2400},
+		{"jitter above 1", Policy{InitialDelay: time.Second, Multiplier: 2, Jitter: 5}, 1, 0, time.Second * 2},
+		{"jitter capped by max delay", Policy{InitialDelay: time.Second, MaxDelay: time.Second * 4, Multiplier: 2, Jitter: 0.5}, 5, time.Second * 2, time.Second * 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				got := test.policy.Delay(test.retry)
+				if got < test.min || got > test.max {
+					t.Fatalf("Delay(%d) = %v, want between %v and %v", test.retry, got, test.min, test.max)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyDo(t *testing.T) {
+	errTemporary := errors.New("temporary")
+	errFatal := errors.New("fatal")
+
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		results      []error
+		wantErr      error
+		wantAttempts int
+	}{
+		{"success", 3, []error{nil}, nil, 1},
+		{"success after retries", 3, []error{errTemporary, errTemporary, nil}, nil, 3},
+		{"attempts exhausted", 3, []error{errTemporary, errTemporary, errTemporary, nil}, errTemporary, 3},
+		{"attempts below 1", 0, []error{errTemporary, nil}, errTemporary, 1},
+		{"permanent error", 5, []error{errTemporary, Permanent(errFatal), nil}, errFatal, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := Policy{InitialDelay: time.Millisecond, Multiplier: 1, MaxAttempts: test.maxAttempts}
+			attempts := 0
+			err := policy.Do(context.Background(), func() error {
+				err := test.results[attempts]
+				attempts++
+				return err
+			})
+			if err != test.wantErr {
+				t.Errorf("Do returned %v, want %v", err, test.wantErr)
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("Do made %d attempts, want %d", attempts, test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestPolicyDoContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{InitialDelay: time.Hour, MaxAttempts: 5}
+	attempts := 0
+	err := policy.Do(ctx, func() error {
+		attempts++
+		cancel()
+		return errors.New("temporary")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do returned %v, want %v", err, context.Canceled)
+	}
+	if attempts != 1 {
+		t.Errorf("Do made %d attempts, want 1", attempts)
+	}
+}
+
+func TestPermanentNil(t *testing.T) {
+	if err := Permanent(nil); err != nil {
+		t.Errorf("Permanent(nil) = %v, want nil", err)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	start := time.Now()
+	if err := Sleep(context.Background(), time.Millisecond*20); err != nil {
+		t.Fatalf("Sleep returned %v, want nil", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*20 {
+		t.Errorf("Sleep returned after %v, want at least 20ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	start = time.Now()
+	if err := Sleep(ctx, time.Hour); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Sleep returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Sleep returned after %v, want it to stop when the context is done", elapsed)
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"goVkBot/internal/models"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxCallbackBodySize limits the size of a single Callback API request body.
+const maxCallbackBodySize = 1 << 20
+
+// callbackShutdownTimeout is how long the HTTP server waits for running requests when stopping.
+const callbackShutdownTimeout = time.Second * 5
+
+// Callback is a Transport that receives updates through the VK Callback API.
+// VK sends every event as a POST request to the configured address.
+//
+// Fields:
+//   - Addr: The address the HTTP server listens on, e.g. ":8080".
+//   - Confirmation: The string returned to VK for the "confirmation" event.
+//   - Secret: The secret key set in the group settings, requests with a different secret are rejected.
+//     If it is empty, the secret is not checked.
+//   - GroupID: The ID of the group, requests sent for another group are rejected.
+//     If it is 0, the group is not checked.
+type Callback struct {
+	Addr         string
+	Confirmation string
+	Secret       string
+	GroupID      int
+}
+
+// callbackRequest contains the fields of a Callback API request needed before the update is decoded.
+type callbackRequest struct {
+	Type    string `json:"type"`
+	GroupID int    `json:"group_id"`
+	Secret  string `json:"secret"`
+}
+
+// Run starts an HTTP server that accepts Callback API requests and sends the received updates
+// to the response channel until the context is cancelled.
+//
+// Note:
+//   - Each request carries a single update, it is sent to the channel as a `models.ServerResponse` with one update.
+//   - On cancellation the server stops accepting requests and waits for running ones before the channel is closed.
+//     If they don't finish in time, the connections are closed and the channel is closed once the handlers return.
+//   - If the server fails to start, the error is logged and the channel is closed, so the receiver knows
+//     no updates will come.
+func (c Callback) Run(ctx context.Context, responseChan chan<- models.ServerResponse) {
+	handlers := &handlerGroup{}
+	defer func() {
+		handlers.wait()
+		close(responseChan)
+	}()
+
+	srv := &http.Server{
+		Addr:              c.Addr,
+		Handler:           c.handler(responseChan, handlers),
+		ReadHeaderTimeout: time.Second * 10,
+		// requests waiting for the response channel give up once the transport is stopped
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.ListenAndServe()
+	}()
+	log.Println("Listening for Callback API requests on", c.Addr)
+
+	select {
+	case err := <-errChan:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Println("Error running the callback server:", err)
+		}
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), callbackShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Println("Error shutting down the callback server:", err)
+			srv.Close()
+		}
+	}
+}
+
+// handlerGroup tracks the running request handlers, so the response channel is closed only after
+// none of them can send to it anymore.
+type handlerGroup struct {
+	mu      sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// start registers a handler, it returns false if the transport is stopping and the request must not be processed.
+func (g *handlerGroup) start() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stopped {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+// done unregisters a handler started with start.
+func (g *handlerGroup) done() {
+	g.wg.Done()
+}
+
+// wait rejects new handlers and waits for the running ones to return.
+func (g *handlerGroup) wait() {
+	g.mu.Lock()
+	g.stopped = true
+	g.mu.Unlock()
+	g.wg.Wait()
+}
+
+// handler returns the HTTP handler that answers Callback API requests.
+//
+// Note:
+//   - The "confirmation" event is answered with the configured confirmation string.
+//   - Requests with a wrong secret or for another group are answered with 403 and not processed.
+//   - Every other event is answered with "ok" as soon as it is passed to the response channel,
+//     VK repeats the request if it doesn't receive "ok".
+func (c Callback) handler(responseChan chan<- models.ServerResponse, handlers *handlerGroup) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !handlers.start() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer handlers.done()
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCallbackBodySize))
+		if err != nil {
+			log.Println("Error reading the callback request:", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		request := callbackRequest{}
+		if err := json.Unmarshal(body, &request); err != nil {
+			log.Println("Error unmarshalling the callback request:", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		// the secret is compared in constant time, so it can't be guessed by timing the responses
+		if c.Secret != "" && subtle.ConstantTimeCompare([]byte(request.Secret), []byte(c.Secret)) != 1 {
+			log.Println("Callback request with a wrong secret rejected")
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if c.GroupID != 0 && request.GroupID != c.GroupID {
+			log.Println("Callback request for another group rejected:", request.GroupID)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		if request.Type == "confirmation" {
+			io.WriteString(w, c.Confirmation)
+			return
+		}
+
+		update := models.Update{}
+		if err := json.Unmarshal(body, &update); err != nil {
+			log.Println("Error unmarshalling the callback update:", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case responseChan <- models.ServerResponse{Updates: []models.Update{update}}:
+			io.WriteString(w, "ok")
+		case <-r.Context().Done():
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"goVkBot/internal/models"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallbackHandler(t *testing.T) {
+	callback := Callback{Confirmation: "a1b2c3", Secret: "secret", GroupID: 1}
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantBody   string
+		wantUpdate bool
+	}{
+		{
+			name:       "confirmation",
+			method:     http.MethodPost,
+			body:       `{"type":"confirmation","group_id":1,"secret":"secret"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   "a1b2c3",
+		},
+		{
+			name:       "update",
+			method:     http.MethodPost,
+			body:       `{"type":"message_new","group_id":1,"event_id":"e1","secret":"secret","object":{"message":{"peer_id":5,"text":"Начать"}}}`,
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+			wantUpdate: true,
+		},
+		{
+			name:       "wrong secret",
+			method:     http.MethodPost,
+			body:       `{"type":"message_new","group_id":1,"event_id":"e1","secret":"guess","object":{}}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "missing secret",
+			method:     http.MethodPost,
+			body:       `{"type":"confirmation","group_id":1}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "another group",
+			method:     http.MethodPost,
+			body:       `{"type":"confirmation","group_id":2,"secret":"secret"}`,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "not JSON",
+			method:     http.MethodPost,
+			body:       `not json`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "GET request",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responseChan := make(chan models.ServerResponse, 1)
+			srv := httptest.NewServer(callback.handler(responseChan, &handlerGroup{}))
+			defer srv.Close()
+
+			req, err := http.NewRequest(test.method, srv.URL, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatalf("error creating the request: %v", err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("error making the request: %v", err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("error reading the response: %v", err)
+			}
+
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, test.wantStatus)
+			}
+			if test.wantBody != "" && string(body) != test.wantBody {
+				t.Errorf("got body %q, want %q", body, test.wantBody)
+			}
+
+			select {
+			case response := <-responseChan:
+				if !test.wantUpdate {
+					t.Fatalf("got response %+v, want none", response)
+				}
+				if len(response.Updates) != 1 || response.Updates[0].EventID != "e1" || response.Updates[0].PeerID() != 5 {
+					t.Errorf("got updates %+v, want the message_new update e1 from peer 5", response.Updates)
+				}
+			case <-time.After(time.Millisecond * 50):
+				if test.wantUpdate {
+					t.Error("the update wasn't passed to the channel")
+				}
+			}
+		})
+	}
+}
+
+func TestCallbackHandlerWithoutChecks(t *testing.T) {
+	responseChan := make(chan models.ServerResponse, 1)
+	srv := httptest.NewServer(Callback{Confirmation: "a1b2c3"}.handler(responseChan, &handlerGroup{}))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"type":"confirmation","group_id":7}`))
+	if err != nil {
+		t.Fatalf("error making the request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want %d when neither the secret nor the group is configured", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestCallbackRunClosesChannelIfServerFails(t *testing.T) {
+	// occupy the port, so the callback server can't listen on it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer listener.Close()
+
+	responseChan := make(chan models.ServerResponse)
+	go Callback{Addr: listener.Addr().String()}.Run(context.Background(), responseChan)
+
+	select {
+	case _, ok := <-responseChan:
+		if ok {
+			t.Error("got a response, want the channel closed")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("the channel wasn't closed after the server failed to start")
+	}
+}
+
+func TestHandlerGroupWaitsForHandlers(t *testing.T) {
+	handlers := &handlerGroup{}
+	if !handlers.start() {
+		t.Fatal("start returned false before wait")
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		handlers.wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("wait returned while a handler was running")
+	case <-time.After(time.Millisecond * 50):
+	}
+	// handlers arriving while the group is stopping are rejected
+	if handlers.start() {
+		t.Error("start returned true while the group is stopping")
+	}
+
+	handlers.done()
+	select {
+	case <-waited:
+	case <-time.After(time.Second * 5):
+		t.Fatal("wait didn't return after the handler was done")
+	}
+}
@@ -1,54 +1,252 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"goVkBot/internal/bot"
+	"goVkBot/internal/checkpoint"
 	"goVkBot/internal/models"
+	"goVkBot/internal/retry"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
 	"time"
 )
 
+// longPollWait is how long the long poll server holds a request when there are no updates.
+const longPollWait = time.Second * 25
+
+// Transport delivers updates from VK to the response channel.
+// Run blocks until the context is cancelled and closes the response channel before returning.
+// The receiver must call the Done function of a response, if it is set, once all of its updates are handled.
+type Transport interface {
+	Run(ctx context.Context, responseChan chan<- models.ServerResponse)
+}
+
+// LongPoll is a Transport that receives updates through the Bots Long Poll API.
+// If Checkpoint is set, the ts of the last handled batch of updates is saved to it and polling resumes from it after a restart.
+type LongPoll struct {
+	Bot        *bot.Bot
+	Checkpoint checkpoint.Store
+}
+
+// Run listens to the long poll server of the bot, see ListenForResponses.
+func (l LongPoll) Run(ctx context.Context, responseChan chan<- models.ServerResponse) {
+	ListenForResponses(ctx, l.Bot, l.Checkpoint, responseChan)
+}
+
 // ListenForResponses listens for updates from a VK long poll server and sends the updates to a channel for processing.
-// It takes the server URL, the timestamp of the last update received, and a response channel as parameters.
-// The function makes periodic GET requests to the server to check for new updates.
+// It takes the bot holding the long poll server credentials, an optional checkpoint store and a response channel as parameters.
+// The function makes consecutive long poll requests to the server to check for new updates.
 // When an update is received, it is unmarshaled into a `models.ServerResponse` struct.
 // The updated timestamp is extracted from the response and used for the next request.
 // The received response is sent to the provided response channel for further processing.
-func ListenForResponses(b bot.Bot, responseChan chan<- models.ServerResponse) {
-	baseUrl := b.ServerUrl
-	for {
-		resp, err := http.Get(fmt.Sprintf(baseUrl, b.LastTimeStamp))
+// Polling stops as soon as the context is cancelled, after which the response channel is closed.
+//
+// Note:
+//   - If a checkpoint store is given, polling starts from the saved ts instead of the one received from
+//     groups.getLongPollServer. The ts of a response is saved to the store once its Done function has been called,
+//     i.e. after every update of the batch is handled, and only when all earlier batches are handled too.
+//     Updates sent while the bot was down or not handled before it stopped are delivered this way
+//     (at least once, so an update may be handled again after a restart), as long as VK still keeps them.
+//   - "failed":1 — the event history is outdated or partially lost (e.g. the saved checkpoint is too old),
+//     polling continues with the returned ts.
+//   - "failed":2 — the key has expired, a new key is requested while the current ts is kept.
+//   - "failed":3 — the key and ts are lost, both are requested again.
+//   - Transport errors and responses that are not valid JSON are logged and the request is repeated after a delay.
+//   - If the long poll server credentials can't be obtained, the request is repeated after a delay.
+//   - The delay grows with every consecutive failure according to the bot's retry policy and is reset
+//     by the first successful response. The listener itself never gives up.
+func ListenForResponses(ctx context.Context, b *bot.Bot, store checkpoint.Store, responseChan chan<- models.ServerResponse) {
+	defer close(responseChan)
+
+	// resume from the last delivered ts, the long poll server reports "failed":1 if it's too old
+	resumeTs := ""
+	if store != nil {
+		ts, err := store.Load()
 		if err != nil {
-			log.Println("Error making the request:", err)
-			continue
+			log.Println("Error loading the long poll checkpoint:", err)
 		}
+		resumeTs = ts
+	}
+	if resumeTs != "" && b.ServerUrl != "" {
+		log.Println("Resuming long poll from checkpoint ts", resumeTs)
+		b.LastTimeStamp, resumeTs = resumeTs, ""
+	}
+
+	// batches saves the checkpoint as the responses passed to the channel are handled
+	batches := &batchTracker{store: store}
 
-		body, err := io.ReadAll(resp.Body)
+	// failures counts consecutive failed requests to choose the backoff delay
+	failures := 0
+	backoff := func() {
+		failures++
+		retry.Sleep(ctx, b.Retry.Delay(failures))
+	}
+
+	for ctx.Err() == nil {
+		if b.ServerUrl == "" || b.Key == "" {
+			if err := b.GetLongPollServer(ctx); err != nil {
+				if ctx.Err() == nil {
+					log.Println("Error getting long poll server:", err)
+					backoff()
+				}
+				continue
+			}
+			if resumeTs != "" {
+				log.Println("Resuming long poll from checkpoint ts", resumeTs)
+				b.LastTimeStamp, resumeTs = resumeTs, ""
+			}
+		}
+
+		response, err := poll(ctx, b)
 		if err != nil {
-			log.Println("Error reading the response:", err)
+			if ctx.Err() == nil {
+				log.Println("Error polling the long poll server:", err)
+				backoff()
+			}
 			continue
 		}
+		failures = 0
 
-		log.Println(string(body))
+		switch response.Failed {
+		case 0:
+			b.LastTimeStamp = string(response.Ts)
+			response.Done = batches.track(b.LastTimeStamp)
+			select {
+			case responseChan <- response:
+			case <-ctx.Done():
+			}
+		case 1:
+			log.Println("Long poll history is outdated, continuing from ts", response.Ts)
+			b.LastTimeStamp = string(response.Ts)
+			// no updates to handle, but the ts must not be saved before the earlier batches are handled
+			batches.track(b.LastTimeStamp)()
+		case 2:
+			log.Println("Long poll key has expired, requesting a new one")
+			if !refreshKey(ctx, b) {
+				backoff()
+			}
+		case 3:
+			log.Println("Long poll key and ts are lost, requesting new ones")
+			b.ServerUrl, b.Key = "", ""
+		default:
+			log.Println("Unknown long poll failure code:", response.Failed)
+			b.ServerUrl, b.Key = "", ""
+		}
+	}
+}
 
-		updateResponseData := models.ServerResponse{}
-		json.Unmarshal(body, &updateResponseData)
-		b.LastTimeStamp = updateResponseData.Ts
+// poll makes a single request to the long poll server with the credentials stored in the bot.
+// It returns an error if the request fails, the server answers with an unexpected status
+// or the body is not a valid long poll response.
+func poll(ctx context.Context, b *bot.Bot) (models.ServerResponse, error) {
+	response := models.ServerResponse{}
 
-		// TODO: better error handling
-		// "failed":2 — the key has expired
-		// you need to get the key again using the groups.getLongPollServer method.
-		if updateResponseData.Failed == 2 {
-			b.GetLongPollServer()
-			baseUrl = b.ServerUrl
-		}
-		resp.Body.Close()
+	params := url.Values{}
+	params.Set("act", "a_check")
+	params.Set("key", b.Key)
+	params.Set("ts", b.LastTimeStamp)
+	params.Set("wait", strconv.Itoa(int(longPollWait/time.Second)))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.ServerUrl+"?"+params.Encode(), nil)
+	if err != nil {
+		return response, fmt.Errorf("error creating the request: %w", err)
+	}
+	// the server holds the request for up to longPollWait, so it's added to the usual timeout
+	resp, err := b.Client.HTTPClientWithTimeout(b.Client.Timeout + longPollWait).Do(req)
+	if err != nil {
+		return response, fmt.Errorf("error making the request: %w", err)
+	}
+	defer resp.Body.Close()
 
-		responseChan <- updateResponseData
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return response, fmt.Errorf("error reading the response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return response, fmt.Errorf("unexpected response status %s: %s", resp.Status, body)
+	}
+
+	log.Println(string(body))
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		return response, fmt.Errorf("error unmarshalling the response: %w", err)
+	}
+	if response.Failed == 0 && response.Ts == "" {
+		return response, fmt.Errorf("response has no ts: %s", body)
+	}
+	return response, nil
+}
+
+// refreshKey requests a new long poll key while keeping the last received ts,
+// so no events are skipped. If the request fails, the credentials are reset
+// so they will be requested again on the next iteration, and false is returned.
+func refreshKey(ctx context.Context, b *bot.Bot) bool {
+	ts := b.LastTimeStamp
+	if err := b.GetLongPollServer(ctx); err != nil {
+		log.Println("Error getting long poll server:", err)
+		b.ServerUrl, b.Key = "", ""
+		return false
+	}
+	b.LastTimeStamp = ts
+	return true
+}
 
-		time.Sleep(time.Second * 1)
+// saveCheckpoint saves the ts to the store if there is one, errors are only logged
+// since polling can go on without the checkpoint.
+func saveCheckpoint(store checkpoint.Store, ts string) {
+	if store == nil {
+		return
+	}
+	if err := store.Save(ts); err != nil {
+		log.Println("Error saving the long poll checkpoint:", err)
+	}
+}
+
+// batchTracker saves the ts of the long poll responses to the checkpoint store in the order they were received,
+// once the updates of a response and of all responses received before it have been handled.
+// Batches are handled concurrently, so a later batch may be done before an earlier one.
+type batchTracker struct {
+	mu      sync.Mutex
+	store   checkpoint.Store
+	pending []*pendingBatch
+}
+
+// pendingBatch is a response whose ts isn't saved yet.
+type pendingBatch struct {
+	ts   string
+	done bool
+}
+
+// track adds a response with the given ts and returns the function to call once its updates are handled.
+func (t *batchTracker) track(ts string) func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	batch := &pendingBatch{ts: ts}
+	t.pending = append(t.pending, batch)
+	return func() { t.finish(batch) }
+}
+
+// finish marks the batch as handled and saves the ts of the last batch handled along with all batches before it.
+func (t *batchTracker) finish(batch *pendingBatch) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if batch.done {
+		return
+	}
+	batch.done = true
+
+	ts := ""
+	for len(t.pending) > 0 && t.pending[0].done {
+		ts = t.pending[0].ts
+		t.pending = t.pending[1:]
+	}
+	if ts != "" {
+		saveCheckpoint(t.store, ts)
 	}
 }
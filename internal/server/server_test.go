@@ -0,0 +1,284 @@
+package server
+
+import (
+	"context"
+	"goVkBot/internal/bot"
+	"goVkBot/internal/checkpoint"
+	"goVkBot/internal/config"
+	"goVkBot/internal/models"
+	"goVkBot/internal/retry"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResponse is a scripted answer of the fake VK server.
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+// pollRequest holds the parameters of a request to the fake long poll server.
+type pollRequest struct {
+	key string
+	ts  string
+	at  time.Time
+}
+
+// fakeVK serves groups.getLongPollServer and the long poll server from scripted responses.
+// Once the long poll script is exhausted, requests are held until the client gives up, like a long poll with no events.
+type fakeVK struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu              sync.Mutex
+	credentials     []string
+	credentialCalls int
+	polls           []fakeResponse
+	requests        chan pollRequest
+}
+
+func newFakeVK(t *testing.T, polls []fakeResponse) *fakeVK {
+	vk := &fakeVK{t: t, polls: polls, requests: make(chan pollRequest, 100)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/method/groups.getLongPollServer", vk.getLongPollServer)
+	mux.HandleFunc("/lp", vk.poll)
+	vk.server = httptest.NewServer(mux)
+	t.Cleanup(vk.server.Close)
+	return vk
+}
+
+func (vk *fakeVK) getLongPollServer(w http.ResponseWriter, r *http.Request) {
+	vk.mu.Lock()
+	defer vk.mu.Unlock()
+	if len(vk.credentials) == 0 {
+		vk.t.Errorf("unexpected groups.getLongPollServer call %d", vk.credentialCalls+1)
+		http.Error(w, "no credentials left", http.StatusInternalServerError)
+		return
+	}
+	vk.credentialCalls++
+	body := vk.credentials[0]
+	vk.credentials = vk.credentials[1:]
+	io.WriteString(w, body)
+}
+
+func (vk *fakeVK) poll(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	vk.requests <- pollRequest{key: query.Get("key"), ts: query.Get("ts"), at: time.Now()}
+
+	vk.mu.Lock()
+	if len(vk.polls) == 0 {
+		vk.mu.Unlock()
+		<-r.Context().Done()
+		return
+	}
+	response := vk.polls[0]
+	vk.polls = vk.polls[1:]
+	vk.mu.Unlock()
+
+	w.WriteHeader(response.status)
+	io.WriteString(w, response.body)
+}
+
+// credentialsBody returns the body of a groups.getLongPollServer response pointing to the fake long poll server.
+func (vk *fakeVK) credentialsBody(key string, ts string) string {
+	return `{"response":{"key":"` + key + `","server":"` + vk.server.URL + `/lp","ts":"` + ts + `"}}`
+}
+
+// listen runs ListenForResponses with the optional checkpoint store against the fake server
+// until count long poll requests were made and returns the requests together with the responses passed to the channel.
+func (vk *fakeVK) listen(count int, store checkpoint.Store) ([]pollRequest, []models.ServerResponse) {
+	vk.t.Helper()
+
+	b := &bot.Bot{
+		AccessToken: "token",
+		GroupId:     "1",
+		Retry:       retry.Policy{InitialDelay: time.Millisecond * 20, Multiplier: 2, MaxAttempts: 1},
+		Client:      config.Client{BaseURL: vk.server.URL + "/method", APIVersion: "5.131", Timeout: time.Second * 5},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	responseChan := make(chan models.ServerResponse)
+	received := make(chan []models.ServerResponse)
+	go func() {
+		responses := []models.ServerResponse{}
+		for response := range responseChan {
+			responses = append(responses, response)
+		}
+		received <- responses
+	}()
+	go ListenForResponses(ctx, b, store, responseChan)
+
+	requests := []pollRequest{}
+	timeout := time.After(time.Second * 5)
+	for len(requests) < count {
+		select {
+		case request := <-vk.requests:
+			requests = append(requests, request)
+		case <-timeout:
+			vk.t.Fatalf("got %d long poll requests, want %d: %+v", len(requests), count, requests)
+		}
+	}
+	cancel()
+	return requests, <-received
+}
+
+// checkRequests compares the key and ts of the long poll requests with the expected ones.
+func checkRequests(t *testing.T, got []pollRequest, want []pollRequest) {
+	t.Helper()
+	for i := range want {
+		if got[i].key != want[i].key || got[i].ts != want[i].ts {
+			t.Errorf("request %d: got key=%q ts=%q, want key=%q ts=%q", i+1, got[i].key, got[i].ts, want[i].key, want[i].ts)
+		}
+	}
+}
+
+func TestListenForResponsesFailed1AdoptsNumericTs(t *testing.T) {
+	vk := newFakeVK(t, []fakeResponse{{http.StatusOK, `{"failed":1,"ts":42}`}})
+	vk.credentials = []string{vk.credentialsBody("k1", "10")}
+
+	requests, responses := vk.listen(2, nil)
+
+	checkRequests(t, requests, []pollRequest{{key: "k1", ts: "10"}, {key: "k1", ts: "42"}})
+	if vk.credentialCalls != 1 {
+		t.Errorf("got %d groups.getLongPollServer calls, want 1", vk.credentialCalls)
+	}
+	if len(responses) != 0 {
+		t.Errorf("got %d responses passed to the channel, want none", len(responses))
+	}
+}
+
+func TestListenForResponsesFailed2KeepsTs(t *testing.T) {
+	vk := newFakeVK(t, []fakeResponse{
+		{http.StatusOK, `{"ts":"11","updates":[]}`},
+		{http.StatusOK, `{"failed":2}`},
+	})
+	vk.credentials = []string{vk.credentialsBody("k1", "10"), vk.credentialsBody("k2", "99")}
+
+	requests, responses := vk.listen(3, nil)
+
+	checkRequests(t, requests, []pollRequest{{key: "k1", ts: "10"}, {key: "k1", ts: "11"}, {key: "k2", ts: "11"}})
+	if vk.credentialCalls != 2 {
+		t.Errorf("got %d groups.getLongPollServer calls, want 2", vk.credentialCalls)
+	}
+	if len(responses) != 1 || responses[0].Ts != "11" {
+		t.Errorf("got responses %+v, want the one with ts 11", responses)
+	}
+}
+
+func TestListenForResponsesFailed3RefetchesKeyAndTs(t *testing.T) {
+	vk := newFakeVK(t, []fakeResponse{{http.StatusOK, `{"failed":3}`}})
+	vk.credentials = []string{vk.credentialsBody("k1", "10"), vk.credentialsBody("k2", "50")}
+
+	requests, _ := vk.listen(2, nil)
+
+	checkRequests(t, requests, []pollRequest{{key: "k1", ts: "10"}, {key: "k2", ts: "50"}})
+	if vk.credentialCalls != 2 {
+		t.Errorf("got %d groups.getLongPollServer calls, want 2", vk.credentialCalls)
+	}
+}
+
+func TestListenForResponsesRetriesBadResponses(t *testing.T) {
+	vk := newFakeVK(t, []fakeResponse{
+		{http.StatusOK, `not json`},
+		{http.StatusBadGateway, `bad gateway`},
+		{http.StatusOK, `{"ts":"11","updates":[]}`},
+	})
+	vk.credentials = []string{vk.credentialsBody("k1", "10")}
+
+	requests, responses := vk.listen(4, nil)
+
+	checkRequests(t, requests, []pollRequest{{key: "k1", ts: "10"}, {key: "k1", ts: "10"}, {key: "k1", ts: "10"}, {key: "k1", ts: "11"}})
+	// the delays are 20ms after the first failure and 40ms after the second one
+	if gap := requests[1].at.Sub(requests[0].at); gap < time.Millisecond*20 {
+		t.Errorf("retried after %v, want a backoff of at least 20ms", gap)
+	}
+	if gap := requests[2].at.Sub(requests[1].at); gap < time.Millisecond*40 {
+		t.Errorf("retried after %v, want a backoff of at least 40ms", gap)
+	}
+	if len(responses) != 1 || responses[0].Ts != "11" {
+		t.Errorf("got responses %+v, want the one with ts 11", responses)
+	}
+}
+
+func TestListenForResponsesRetriesGetLongPollServerError(t *testing.T) {
+	vk := newFakeVK(t, nil)
+	vk.credentials = []string{
+		`{"error":{"error_code":5,"error_msg":"User authorization failed"}}`,
+		vk.credentialsBody("k1", "10"),
+	}
+
+	requests, _ := vk.listen(1, nil)
+
+	checkRequests(t, requests, []pollRequest{{key: "k1", ts: "10"}})
+	if vk.credentialCalls != 2 {
+		t.Errorf("got %d groups.getLongPollServer calls, want 2", vk.credentialCalls)
+	}
+}
+
+// memoryStore is a checkpoint store keeping the saved values in memory, Load returns ts.
+type memoryStore struct {
+	mu    sync.Mutex
+	ts    string
+	saved []string
+}
+
+func (s *memoryStore) Load() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ts, nil
+}
+
+func (s *memoryStore) Save(ts string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ts = ts
+	s.saved = append(s.saved, ts)
+	return nil
+}
+
+func TestListenForResponsesResumesFromCheckpoint(t *testing.T) {
+	vk := newFakeVK(t, []fakeResponse{{http.StatusOK, `{"failed":1,"ts":42}`}})
+	vk.credentials = []string{vk.credentialsBody("k1", "10")}
+	store := &memoryStore{ts: "5"}
+
+	requests, _ := vk.listen(2, store)
+
+	// polling starts from the stored ts, and the ts returned with "failed":1 replaces the outdated one
+	checkRequests(t, requests, []pollRequest{{key: "k1", ts: "5"}, {key: "k1", ts: "42"}})
+	if len(store.saved) != 1 || store.saved[0] != "42" {
+		t.Errorf("saved %v, want [42]", store.saved)
+	}
+}
+
+func TestBatchTrackerSavesHandledBatchesInOrder(t *testing.T) {
+	store := &memoryStore{}
+	batches := &batchTracker{store: store}
+
+	first := batches.track("11")
+	second := batches.track("12")
+	third := batches.track("13")
+
+	second()
+	if len(store.saved) != 0 {
+		t.Fatalf("saved %v before the first batch was handled", store.saved)
+	}
+	first()
+	third()
+	third()
+	batches.track("14")()
+
+	want := []string{"12", "13", "14"}
+	if len(store.saved) != len(want) {
+		t.Fatalf("saved %v, want %v", store.saved, want)
+	}
+	for i := range want {
+		if store.saved[i] != want[i] {
+			t.Errorf("saved %v, want %v", store.saved, want)
+		}
+	}
+}
@@ -3,11 +3,11 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"goVkBot/internal/config"
 	"goVkBot/internal/models"
 	"io"
 	"log"
 	"math/rand"
-	"net/http"
 	"strconv"
 	"time"
 )
@@ -29,32 +29,11 @@ func GetRandomInt32() string {
 	return strconv.Itoa(int(randomNumber))
 }
 
-// CreateButton creates a button with the specified label, link, color, type, and payload.
-// It returns a models.Button struct representing the created button.
-//
-// Parameters:
-//   - label: The label or text displayed on the button.
-//   - link: The URL link associated with the button (optional, can be an empty string).
-//   - color: The color of the button (optional, can be an empty string).
-//   - typeOfButton: The type of the button, such as "text" or "open_link".
-//   - payload: The payload associated with the button (optional, can be an empty string).
-//
-// Returns:
-//   - models.Button: The created button with the specified properties.
-func CreateButton(label string, link string, color string, typeOfButton string, payload string) models.Button {
-	button := models.Button{}
-	button.Action.Label = label
-	button.Action.Link = link
-	button.Color = color
-	button.Action.Type = typeOfButton
-	button.Action.Payload = payload
-	return button
-}
-
 // GetWeatherInfo retrieves weather information for the specified city.
 // It makes a request to the weather service API and returns the current temperature as a string.
 //
 // Parameters:
+//   - cfg: The client configuration holding the weather service address, timeout and transport.
 //   - city: The name of the city for which weather information is requested.
 //
 // Returns:
@@ -68,15 +47,27 @@ func CreateButton(label string, link string, color string, typeOfButton string,
 // Note:
 //   - The weather service API used in this function may have limitations or require proper authentication.
 //     Ensure that you have the necessary permissions and provide valid API endpoints for other cities if needed.
-func GetWeatherInfo(city string) string {
+func GetWeatherInfo(cfg config.Client, city string) string {
 	cityUrl := ""
 	if city == "Moscow" {
-		cityUrl = "https://api.open-meteo.com/v1/forecast?latitude=55.75&longitude=37.62&hourly=temperature_2m&current_weather=true&forecast_days=1&timezone=Europe%2FMoscow"
+		cityUrl = cfg.WeatherURL + "?latitude=55.75&longitude=37.62&hourly=temperature_2m&current_weather=true&forecast_days=1&timezone=Europe%2FMoscow"
 	}
 	if city == "London" {
-		cityUrl = "https://api.open-meteo.com/v1/forecast?latitude=51.51&longitude=-0.13&hourly=temperature_2m&current_weather=true"
+		cityUrl = cfg.WeatherURL + "?latitude=51.51&longitude=-0.13&hourly=temperature_2m&current_weather=true"
 	}
-	response, err := http.Get(cityUrl)
+	return getTemperature(cfg, cityUrl)
+}
+
+// GetWeatherByLocation retrieves the current temperature at the given coordinates, e.g. the location sent by the user.
+// Like GetWeatherInfo, it returns an empty string if an error occurs.
+func GetWeatherByLocation(cfg config.Client, latitude float64, longitude float64) string {
+	locationUrl := fmt.Sprintf("%s?latitude=%.2f&longitude=%.2f&current_weather=true", cfg.WeatherURL, latitude, longitude)
+	return getTemperature(cfg, locationUrl)
+}
+
+// getTemperature requests the weather service and returns the current temperature from its response.
+func getTemperature(cfg config.Client, weatherUrl string) string {
+	response, err := cfg.HTTPClient().Get(weatherUrl)
 	if err != nil {
 		log.Println("error making request to weather service:", err)
 		return ""
@@ -100,6 +91,9 @@ func GetWeatherInfo(city string) string {
 
 // GetRandomCat retrieves a URL of a random cat image from the Cataas service.
 //
+// Parameters:
+//   - cfg: The client configuration holding the Cataas address, timeout and transport.
+//
 // Returns:
 //   - A string containing the URL of a random cat image.
 //   - An empty string if an error occurs during the HTTP request or response handling.
@@ -109,9 +103,9 @@ func GetWeatherInfo(city string) string {
 //   - The URL of the cat image is extracted from the response body.
 //   - Error handling is performed for the HTTP request creation and response handling.
 //     If an error occurs, an error message is logged, and an empty string is returned.
-func GetRandomCat() string {
-	catUrl := "https://cataas.com/cat?json=true"
-	response, err := http.Get(catUrl)
+func GetRandomCat(cfg config.Client) string {
+	catUrl := cfg.CatURL + "/cat?json=true"
+	response, err := cfg.HTTPClient().Get(catUrl)
 	if err != nil {
 		log.Println(err)
 		return ""
@@ -130,31 +124,5 @@ func GetRandomCat() string {
 		log.Println("error unmarshalling body", err)
 		return ""
 	}
-	return "https://cataas.com/" + catData.URL
-}
-
-// MakePostRequestWithUrl makes a POST request to the specified URL without sending any request body.
-// It sends an empty form body to the URL and prints the response body and status to the standard output.
-//
-// Parameters:
-//   - url: The URL to which the POST request is made.
-//
-// Note:
-//   - This function does not send any request body. It only sends an empty form body.
-//   - The response body and status are printed to the standard output for debugging or informational purposes.
-//   - Error handling is performed for the HTTP request creation, but not for reading the response body.
-//     Make sure to handle errors appropriately in a production environment.
-func MakePostRequestWithUrl(url string) {
-	resp, err := http.PostForm(url, nil)
-	if err != nil {
-		fmt.Println("Error creating request:", err)
-		return
-	}
-
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Println(string(body))
-
-	defer resp.Body.Close()
-
-	fmt.Println("Response status:", resp.Status)
+	return cfg.CatURL + "/" + catData.URL
 }
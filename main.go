@@ -1,18 +1,69 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"goVkBot/internal/bot"
+	"goVkBot/internal/checkpoint"
+	"goVkBot/internal/config"
+	"goVkBot/internal/dedup"
+	"goVkBot/internal/dispatcher"
+	"goVkBot/internal/keyboard"
 	"goVkBot/internal/models"
+	"goVkBot/internal/ratelimit"
+	"goVkBot/internal/retry"
 	"goVkBot/internal/server"
 	"goVkBot/internal/utils"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// defaultShutdownTimeout is how long in-flight updates are given to finish after a shutdown signal.
+const defaultShutdownTimeout = time.Second * 10
+
+// defaultRateLimit is the number of VK API requests per second if RATE_LIMIT is not set.
+const defaultRateLimit = 20
+
+// defaultRateBurst is the number of VK API requests allowed at once if RATE_BURST is not set.
+const defaultRateBurst = 20
+
+// defaultWorkers is the number of updates handled at the same time if WORKERS is not set.
+const defaultWorkers = 8
+
+// defaultQueueSize is the number of updates waiting for every worker if QUEUE_SIZE is not set.
+const defaultQueueSize = 100
+
+// defaultDedupSize is the number of remembered event IDs if DEDUP_SIZE is not set.
+const defaultDedupSize = 10000
+
+// defaultDedupTTL is how long event IDs are remembered if DEDUP_TTL is not set.
+const defaultDedupTTL = time.Minute * 10
+
+// defaultClientsSize is the number of conversations whose client info is remembered if CLIENTS_SIZE is not set.
+const defaultClientsSize = 10000
+
+// defaultClientsTTL is how long the client info of a conversation is remembered if CLIENTS_TTL is not set.
+const defaultClientsTTL = time.Hour * 24
+
+// defaultMessagesSize is the number of sent messages remembered for editing if MESSAGES_SIZE is not set.
+const defaultMessagesSize = 10000
+
+// defaultMessagesTTL is how long a sent message is remembered for editing if MESSAGES_TTL is not set.
+const defaultMessagesTTL = time.Hour * 24
+
+// defaultCheckpointFile is where the long poll ts is saved if CHECKPOINT_FILE is not set.
+const defaultCheckpointFile = "longpoll.ts"
+
+// defaultCallbackAddr is the address the Callback API server listens on if CALLBACK_ADDR is not set.
+const defaultCallbackAddr = ":8080"
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -20,98 +71,493 @@ func main() {
 	}
 	token := os.Getenv("TOKEN")
 	groupId := os.Getenv("GROUPID")
+	shutdownTimeout := envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+
+	// retry policy for failed requests to VK
+	retryPolicy := retry.DefaultPolicy()
+	retryPolicy.InitialDelay = envDuration("RETRY_INITIAL_DELAY", retryPolicy.InitialDelay)
+	retryPolicy.MaxDelay = envDuration("RETRY_MAX_DELAY", retryPolicy.MaxDelay)
+	retryPolicy.Jitter = envFloat("RETRY_JITTER", retryPolicy.Jitter)
+	retryPolicy.MaxAttempts = envInt("RETRY_MAX_ATTEMPTS", retryPolicy.MaxAttempts)
+
+	// addresses, version and timeouts of the VK API and the external services
+	clientConfig := config.Default()
+	clientConfig.BaseURL = envString("VK_API_URL", clientConfig.BaseURL)
+	clientConfig.APIVersion = envString("VK_API_VERSION", clientConfig.APIVersion)
+	clientConfig.Timeout = envDuration("HTTP_TIMEOUT", clientConfig.Timeout)
+	clientConfig.WeatherURL = envString("WEATHER_API_URL", clientConfig.WeatherURL)
+	clientConfig.CatURL = envString("CAT_API_URL", clientConfig.CatURL)
+
+	// stop polling as soon as the container is asked to stop
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// populate the bot with data
-	myBot := bot.Bot{AccessToken: token, GroupId: groupId}
+	myBot := &bot.Bot{AccessToken: token, GroupId: groupId, Retry: retryPolicy, Client: clientConfig}
+
+	// VK allows group tokens about 20 requests per second
+	myBot.Limiter = ratelimit.New(envFloat("RATE_LIMIT", defaultRateLimit), envInt("RATE_BURST", defaultRateBurst))
+	// adapt the keyboards to the clients of the users
+	myBot.Clients = bot.NewClientRegistry(envInt("CLIENTS_SIZE", defaultClientsSize), envDuration("CLIENTS_TTL", defaultClientsTTL))
 
-	// receieve address of LongPollServer
-	myBot.GetLongPollServer()
+	// choose how updates are delivered from VK
+	var transport server.Transport
+	switch os.Getenv("TRANSPORT") {
+	case "", "longpoll":
+		// receieve address of LongPollServer
+		if err := myBot.GetLongPollServer(ctx); err != nil {
+			log.Fatal("Error getting long poll server:", err)
+		}
+		checkpointFile := envString("CHECKPOINT_FILE", defaultCheckpointFile)
+		transport = server.LongPoll{Bot: myBot, Checkpoint: checkpoint.FileStore{Path: checkpointFile}}
+	case "callback":
+		addr := envString("CALLBACK_ADDR", defaultCallbackAddr)
+		callbackGroupID, err := strconv.Atoi(groupId)
+		if err != nil {
+			log.Fatal("Invalid GROUPID: ", groupId)
+		}
+		transport = server.Callback{Addr: addr, Confirmation: os.Getenv("CONFIRMATION"), Secret: os.Getenv("SECRET"), GroupID: callbackGroupID}
+	default:
+		log.Fatal("Unknown TRANSPORT: ", os.Getenv("TRANSPORT"))
+	}
 
-	// create a channel to listen for responses from LongPollServer
+	// create a channel to receive updates from VK
 	responseChan := make(chan models.ServerResponse, 1)
 
-	// start a goroutine that listens to the LongPollServer continiously
-	go server.ListenForResponses(myBot, responseChan)
-
-	// map to contain last messages sent by bot
-	lastMessageId := map[int]int{}
-
-	// handle the responses from the LongPollServer accordingly
-	for response := range responseChan {
-		if len(response.Updates) > 0 {
-			userMessage := response.Updates[0].Object.Message.Text
-			payload := response.Updates[0].Object.Payload
-			if userMessage == "Начать" {
-				weatherButton := utils.CreateButton("Получить погоду", "", "primary", "text", "")
-				googleButton := utils.CreateButton("Go to google.com", "https://google.com", "", "open_link", "")
-				catsButton := utils.CreateButton("Получить фото кота!", "", "", "text", "")
-				bookTable := utils.CreateButton("Забронировать столик", "", "primary", "text", "")
-				keyboard := models.Keyboard{Inline: false, Buttons: [][]models.Button{{weatherButton}, {googleButton}, {catsButton}, {bookTable}}}
-				myBot.SendMessageToServer("Привет! Этот бот был сделан для VK \n Выбери что-то из кнопок снизу:", response, keyboard)
-			}
-			if userMessage == "Получить погоду" {
-				temperature := utils.GetWeatherInfo("Moscow")
-				message := fmt.Sprintf("Погода в Москве: %s \u2103", temperature)
-				moscowButton := utils.CreateButton("Москва", "", "", "callback", "{\"button\": \"moscow\"}")
-				londonButton := utils.CreateButton("London", "", "", "callback", "{\"button\": \"london\"}")
-				keyboard := models.Keyboard{Inline: true, Buttons: [][]models.Button{{moscowButton}, {londonButton}}}
-				myBot.SendMessageToServer(message, response, keyboard)
-				lastMessageId[response.Updates[0].Object.Message.PeerID] = response.Updates[0].Object.Message.ConversationMessageID + 1
-			}
-			if userMessage == "Получить фото кота!" {
-				catPicture := utils.GetRandomCat()
-				myBot.SendMessageToServer(catPicture, response, models.Keyboard{})
-			}
-			if fmt.Sprintf("%s", payload) == "{moscow}" {
-				temperature := utils.GetWeatherInfo("Moscow")
-				message := fmt.Sprintf("Погода в Москве: %s \u2103", temperature)
-				cmId := strconv.Itoa(lastMessageId[response.Updates[0].Object.PeerID])
-				moscowButton := utils.CreateButton("Москва", "", "", "callback", "{\"button\": \"moscow\"}")
-				londonButton := utils.CreateButton("London", "", "", "callback", "{\"button\": \"london\"}")
-				keyboard := models.Keyboard{Inline: true, Buttons: [][]models.Button{{moscowButton}, {londonButton}}}
-				myBot.EditLastMessage(message, response, cmId, keyboard)
-			}
-			if fmt.Sprintf("%s", payload) == "{london}" {
-				temperature := utils.GetWeatherInfo("London")
-				message := fmt.Sprintf("Погода в Лондоне: %s \u2103", temperature)
-				cmId := strconv.Itoa(lastMessageId[response.Updates[0].Object.PeerID])
-				moscowButton := utils.CreateButton("Москва", "", "", "callback", "{\"button\": \"moscow\"}")
-				londonButton := utils.CreateButton("London", "", "", "callback", "{\"button\": \"london\"}")
-				keyboard := models.Keyboard{Inline: true, Buttons: [][]models.Button{{moscowButton}, {londonButton}}}
-				myBot.EditLastMessage(message, response, cmId, keyboard)
-			}
-			if userMessage == "Забронировать столик" {
-				time1600 := utils.CreateButton("16:00", "", "", "callback", "{\"button\": \"time\"}")
-				time1700 := utils.CreateButton("17:00", "", "", "callback", "{\"button\": \"time\"}")
-				time1800 := utils.CreateButton("18:00", "", "", "callback", "{\"button\": \"time\"}")
-				time1900 := utils.CreateButton("19:00", "", "", "callback", "{\"button\": \"time\"}")
-				keyboard := models.Keyboard{Inline: true, Buttons: [][]models.Button{{time1600}, {time1700}, {time1800}, {time1900}}}
-				myBot.SendMessageToServer("Выберите время:", response, keyboard)
+	// start a goroutine that receives updates until the context is cancelled
+	go transport.Run(ctx, responseChan)
+
+	// messages sent by the bot that are edited later, e.g. the weather message
+	messages := bot.NewMessageRegistry(envInt("MESSAGES_SIZE", defaultMessagesSize), envDuration("MESSAGES_TTL", defaultMessagesTTL))
+
+	// handlers keep running after the shutdown signal until the shutdown deadline
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	defer cancelHandlers()
+
+	// handle updates concurrently, keeping the order of updates within one conversation
+	updateDispatcher := dispatcher.New(envInt("WORKERS", defaultWorkers), envInt("QUEUE_SIZE", defaultQueueSize), func(update models.Update) {
+		handleUpdate(handlerCtx, myBot, update, messages)
+	})
+
+	// remember recently handled events, VK may deliver the same update more than once
+	duplicates := dedup.New(envInt("DEDUP_SIZE", defaultDedupSize), envDuration("DEDUP_TTL", defaultDedupTTL))
+
+	// dispatch every update received from VK individually, so none of the
+	// events delivered in one batch get lost
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		for response := range responseChan {
+			// the transport is told when the whole batch is handled, so the long poll checkpoint
+			// only moves past updates that won't be lost on a restart
+			batch := &sync.WaitGroup{}
+			for _, update := range response.Updates {
+				if duplicates.Seen(update.EventID) {
+					log.Printf("Duplicate update %s dropped, %d duplicates dropped so far", update.EventID, duplicates.Dropped())
+					continue
+				}
+				batch.Add(1)
+				updateDispatcher.Dispatch(update, batch.Done)
 			}
-			if fmt.Sprintf("%s", payload) == "{time}" {
-				eventData := models.EventAnswer{Type: "show_snackbar", Text: "Время подтверждено!"}
-				myBot.HandleButtonCallback(eventData, response)
-				yesButton := utils.CreateButton("Да", "", "positive", "callback", "{\"button\": \"confirm\"}")
-				noButton := utils.CreateButton("Нет", "", "negative", "callback", "{\"button\": \"back\"}")
-				keyboard := models.Keyboard{Inline: true, Buttons: [][]models.Button{{yesButton}, {noButton}}}
-				myBot.SendMessageToServer("Подтвердить бронь?", response, keyboard)
+			if response.Done != nil {
+				go func(done func()) {
+					batch.Wait()
+					done()
+				}(response.Done)
 			}
-			if fmt.Sprintf("%s", payload) == "{confirm}" {
-				eventData := models.EventAnswer{Type: "show_snackbar", Text: "Ваша заявка принята! \nМенеджер свяжется с вами в течение часа для потверждения брони."}
-				myBot.HandleButtonCallback(eventData, response)
-				myBot.SendMessageToServer("Вы сделали заявку, ождидайте звонка менеджера.", response, models.Keyboard{})
+		}
+	}()
+
+	// the transport only stops on its own if it failed, e.g. the callback server couldn't listen on its port
+	transportFailed := false
+	select {
+	case <-ctx.Done():
+	case <-received:
+		log.Println("Transport stopped receiving updates")
+		transportFailed = true
+	}
+	log.Println("Shutting down, waiting for in-flight updates to be handled")
+	log.Println("Duplicate updates dropped:", duplicates.Dropped())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
+	// the transport closes responseChan once it stops, so received is closed
+	// when the updates already received have been dispatched
+	select {
+	case <-received:
+	case <-shutdownCtx.Done():
+	}
+	err = shutdownCtx.Err()
+	if err == nil {
+		err = updateDispatcher.Shutdown(shutdownCtx)
+	}
+	if err != nil {
+		log.Println("Shutdown timeout exceeded, exiting with updates still in flight")
+	} else {
+		log.Println("All updates handled, exiting")
+	}
+	if transportFailed {
+		log.Fatal("Exiting because the transport failed")
+	}
+}
+
+// envString returns the value of the environment variable, or def if it is not set.
+func envString(name string, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// envDuration returns the duration stored in the environment variable, or def if it is not set.
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Error parsing %s: %v", name, err)
+	}
+	return duration
+}
+
+// envInt returns the integer stored in the environment variable, or def if it is not set.
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Error parsing %s: %v", name, err)
+	}
+	return number
+}
+
+// envFloat returns the floating point number stored in the environment variable, or def if it is not set.
+func envFloat(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("Error parsing %s: %v", name, err)
+	}
+	return number
+}
+
+// lastWeatherMessage returns the weather message to edit when a city is chosen.
+// A callback button comes with the message it is attached to, and callback buttons are only attached to the weather message.
+// A city chosen with a text button comes without it, the last weather message sent to the conversation is used then,
+// if the bot still remembers it.
+func lastWeatherMessage(messages *bot.MessageRegistry, peerID int, event *models.MessageEvent) (models.SentMessage, bool) {
+	if event != nil {
+		return models.SentMessage{PeerID: event.PeerID, ConversationMessageID: event.ConversationMessageID}, true
+	}
+	return messages.Last(peerID, "weather")
+}
+
+// logAPIError logs an error returned by a VK API call, pointing out the errors that need attention.
+func logAPIError(err error) {
+	switch {
+	case bot.IsErrorCode(err, bot.ErrorCodeCantSendToUser):
+		log.Println("Can't send messages to the user, messages from the group aren't allowed:", err)
+	case bot.IsErrorCode(err, bot.ErrorCodeTooManyRequests):
+		log.Println("Too many requests to VK API:", err)
+	default:
+		log.Println("Error calling VK API:", err)
+	}
+}
+
+// executeBatch submits the batch and logs the error of the whole batch or of every call that failed.
+func executeBatch(ctx context.Context, batch *bot.Batch) {
+	errs, err := batch.Execute(ctx)
+	if err != nil {
+		logAPIError(err)
+		return
+	}
+	for _, err := range errs {
+		if err != nil {
+			logAPIError(err)
+		}
+	}
+}
+
+// replyOptions quotes the user's message when replying in a group chat, so it's clear which message the bot answers.
+// Private messages need no quote.
+func replyOptions(message models.Message) []bot.SendOption {
+	if !message.IsChat() {
+		return nil
+	}
+	return []bot.SendOption{bot.ReplyToMessage(message)}
+}
+
+// handleUpdate reacts to a single update received from VK.
+// The context is cancelled when the handler runs past the shutdown deadline.
+// messages keeps the weather messages sent by the bot, so the weather buttons can edit them.
+func handleUpdate(ctx context.Context, myBot *bot.Bot, update models.Update, messages *bot.MessageRegistry) {
+	switch event := update.Object.(type) {
+	case models.MessageNew:
+		handleMessage(ctx, myBot, event, messages)
+	case models.MessageEvent:
+		handleButtonCallback(ctx, myBot, event, messages)
+	case models.GroupJoin:
+		log.Println("User joined the group:", event.UserID)
+	case models.GroupLeave:
+		log.Println("User left the group:", event.UserID)
+	case models.VKPayTransaction:
+		log.Printf("User %d paid %d with VK Pay: %s", event.FromID, event.Amount, event.Description)
+	case models.AppPayload:
+		log.Printf("App %d sent a payload for user %d: %s", event.AppID, event.UserID, event.Payload)
+	case nil:
+		if update.DecodeErr != nil {
+			log.Printf("Error decoding update %s of type %s: %v: %s", update.EventID, update.Type, update.DecodeErr, update.RawObject)
+			return
+		}
+		log.Printf("Update %s of type %s not handled: %s", update.EventID, update.Type, update.RawObject)
+	}
+}
+
+// Commands of the bot, sent in the payloads of its buttons.
+const (
+	commandStart   = "start"
+	commandWeather = "weather"
+	commandCat     = "cat"
+	commandBook    = "book"
+	commandTime    = "time"
+	commandConfirm = "confirm"
+	commandBack    = "back"
+)
+
+// textCommands maps the labels of the bot's text buttons to their commands,
+// so the commands also work when the user types the label instead of pressing the button.
+var textCommands = map[string]string{
+	"Начать":               commandStart,
+	"Получить погоду":      commandWeather,
+	"Получить фото кота!":  commandCat,
+	"Забронировать столик": commandBook,
+}
+
+// weatherCities maps the cities the weather is available for to their names used in the messages.
+var weatherCities = map[string]string{
+	"Moscow": "Москве",
+	"London": "Лондоне",
+}
+
+// messageCommand returns the command sent with the message, taken from the payload of the pressed text button,
+// from the button of the text menu the user chose by its number or from the text typed by the user.
+func messageCommand(myBot *bot.Bot, message models.Message) models.Command {
+	if command, ok := message.Payload.Command(); ok {
+		return command
+	}
+	if button, ok := myBot.Clients.Choice(message.PeerID, message.Text); ok {
+		if command, ok := models.Payload(button.Action.Payload).Command(); ok {
+			return command
+		}
+		return models.Command{Cmd: textCommands[button.Action.Label]}
+	}
+	return models.Command{Cmd: textCommands[message.Text]}
+}
+
+// menuKeyboard returns the keyboard with the main menu of the bot.
+func menuKeyboard() (models.Keyboard, error) {
+	return keyboard.New().
+		Row(keyboard.Text("Получить погоду", keyboard.ColorPrimary, models.Command{Cmd: commandWeather}.Payload())).
+		Row(keyboard.OpenLink("Go to google.com", "https://google.com", "")).
+		Row(keyboard.Text("Получить фото кота!", "", models.Command{Cmd: commandCat}.Payload())).
+		Row(keyboard.Text("Забронировать столик", keyboard.ColorPrimary, models.Command{Cmd: commandBook}.Payload())).
+		Row(keyboard.Location("")).
+		Build()
+}
+
+// weatherKeyboard returns the keyboard attached to the weather message to switch between the cities.
+func weatherKeyboard() (models.Keyboard, error) {
+	return keyboard.NewInline().
+		Row(keyboard.Callback("Москва", "", models.Command{Cmd: commandWeather, Args: map[string]string{"city": "Moscow"}}.Payload())).
+		Row(keyboard.Callback("London", "", models.Command{Cmd: commandWeather, Args: map[string]string{"city": "London"}}.Payload())).
+		Build()
+}
+
+// bookingKeyboard returns the keyboard to choose the time of the booking.
+func bookingKeyboard() (models.Keyboard, error) {
+	builder := keyboard.NewInline()
+	for _, bookingTime := range []string{"16:00", "17:00", "18:00", "19:00"} {
+		builder.Row(keyboard.Callback(bookingTime, "", models.Command{Cmd: commandTime, Args: map[string]string{"time": bookingTime}}.Payload()))
+	}
+	return builder.Build()
+}
+
+// confirmationKeyboard returns the keyboard to confirm the booking at the given time.
+func confirmationKeyboard(bookingTime string) (models.Keyboard, error) {
+	return keyboard.NewInline().
+		Row(keyboard.Callback("Да", keyboard.ColorPositive, models.Command{Cmd: commandConfirm, Args: map[string]string{"time": bookingTime}}.Payload())).
+		Row(keyboard.Callback("Нет", keyboard.ColorNegative, models.Command{Cmd: commandBack}.Payload())).
+		Build()
+}
+
+// weatherMessage returns the text of the weather message for the city.
+func weatherMessage(myBot *bot.Bot, city string) string {
+	temperature := utils.GetWeatherInfo(myBot.Client, city)
+	return fmt.Sprintf("Погода в %s: %s \u2103", weatherCities[city], temperature)
+}
+
+// handleMessage reacts to a message sent to the bot.
+func handleMessage(ctx context.Context, myBot *bot.Bot, event models.MessageNew, messages *bot.MessageRegistry) {
+	peerID := event.Message.PeerID
+	reply := replyOptions(event.Message)
+	myBot.Clients.Remember(peerID, event.ClientInfo)
+	for _, attachment := range event.Message.Attachments {
+		if attachment.DecodeErr != nil {
+			log.Printf("Error decoding attachment %s of message %d: %v: %s", attachment.Type, event.Message.ID, attachment.DecodeErr, attachment.RawObject)
+		}
+	}
+	// the location button sends the location of the user without any text
+	if location, ok := event.Message.Geo(); ok {
+		temperature := utils.GetWeatherByLocation(myBot.Client, location.Coordinates.Latitude, location.Coordinates.Longitude)
+		if _, err := myBot.SendMessageToServer(ctx, fmt.Sprintf("Погода рядом с вами: %s \u2103", temperature), peerID, models.Keyboard{}, reply...); err != nil {
+			logAPIError(err)
+		}
+		return
+	}
+	command := messageCommand(myBot, event.Message)
+	switch command.Cmd {
+	case commandStart:
+		menu, err := menuKeyboard()
+		if err != nil {
+			log.Println("Error building the menu keyboard:", err)
+			return
+		}
+		if _, err := myBot.SendMessageToServer(ctx, "Привет! Этот бот был сделан для VK \n Выбери что-то из кнопок снизу:", peerID, menu, reply...); err != nil {
+			logAPIError(err)
+		}
+	case commandWeather:
+		// a city is only chosen with the buttons under the weather message,
+		// they arrive as text buttons for clients without callback buttons
+		if command.Arg("city") != "" {
+			handleCommand(ctx, myBot, command, peerID, nil, messages)
+			return
+		}
+		sendWeather(ctx, myBot, "Moscow", peerID, messages, reply...)
+	case commandCat:
+		catPicture := utils.GetRandomCat(myBot.Client)
+		if catPicture == "" {
+			// the cat service is unavailable, there is neither a photo to upload nor a link to fall back to
+			if _, err := myBot.SendMessageToServer(ctx, "Не удалось получить фото кота, попробуйте позже.", peerID, models.Keyboard{}, reply...); err != nil {
+				logAPIError(err)
 			}
-			if fmt.Sprintf("%s", payload) == "{back}" {
-				eventData := models.EventAnswer{Type: "show_snackbar", Text: "Вы вернулись назад."}
-				myBot.HandleButtonCallback(eventData, response)
-				weatherButton := utils.CreateButton("Получить погоду", "", "", "text", "")
-				googleButton := utils.CreateButton("Go to google.com", "", "https://google.com", "open_link", "")
-				catsButton := utils.CreateButton("Получить фото кота!", "", "", "text", "")
-				bookTable := utils.CreateButton("Забронировать столик", "", "", "text", "")
-				keyboard := models.Keyboard{Inline: false, Buttons: [][]models.Button{{weatherButton}, {googleButton}, {catsButton}, {bookTable}}}
-				myBot.SendMessageToServer("Привет! Этот бот был сделан для VK \n Выбери что-то из кнопок снизу:", response, keyboard)
+			return
+		}
+		photo, err := myBot.UploadPhotoFromURL(ctx, peerID, catPicture)
+		if err != nil {
+			// fall back to sending the link, VK shows a preview for it
+			log.Println("Error uploading the cat photo:", err)
+			if _, err := myBot.SendMessageToServer(ctx, catPicture, peerID, models.Keyboard{}, reply...); err != nil {
+				logAPIError(err)
 			}
+			return
+		}
+		if _, err := myBot.SendMessageToServer(ctx, "", peerID, models.Keyboard{}, append(reply, bot.WithAttachment(photo))...); err != nil {
+			logAPIError(err)
+		}
+	case commandBook:
+		times, err := bookingKeyboard()
+		if err != nil {
+			log.Println("Error building the booking keyboard:", err)
+			return
+		}
+		if _, err := myBot.SendMessageToServer(ctx, "Выберите время:", peerID, times, reply...); err != nil {
+			logAPIError(err)
+		}
+	case commandTime, commandConfirm, commandBack:
+		handleCommand(ctx, myBot, command, peerID, nil, messages)
+	}
+}
+
+// sendWeather sends the weather message for the city and remembers it, so the weather buttons can edit it.
+func sendWeather(ctx context.Context, myBot *bot.Bot, city string, peerID int, messages *bot.MessageRegistry, opts ...bot.SendOption) {
+	cities, err := weatherKeyboard()
+	if err != nil {
+		log.Println("Error building the weather keyboard:", err)
+		return
+	}
+	sent, err := myBot.SendMessageToServer(ctx, weatherMessage(myBot, city), peerID, cities, opts...)
+	if err != nil {
+		logAPIError(err)
+	}
+	if len(sent) > 0 {
+		messages.Remember("weather", sent[0])
+	}
+}
+
+// handleButtonCallback reacts to a callback button pressed by the user.
+func handleButtonCallback(ctx context.Context, myBot *bot.Bot, event models.MessageEvent, messages *bot.MessageRegistry) {
+	command, ok := event.Payload.Command()
+	if !ok {
+		log.Printf("Callback with an unknown payload ignored: %s", event.Payload)
+		return
+	}
+	handleCommand(ctx, myBot, command, event.PeerID, &event, messages)
+}
+
+// handleCommand runs the command of a callback button.
+// The event is nil if the button was sent as a text button to a client without callback buttons,
+// there is no callback to answer then and the last weather message remembered by the bot is edited,
+// or a new one is sent if the bot doesn't remember it.
+func handleCommand(ctx context.Context, myBot *bot.Bot, command models.Command, peerID int, event *models.MessageEvent, messages *bot.MessageRegistry) {
+	// answer the callback and send the next message in one request
+	batch := myBot.NewBatch()
+	answer := func(eventData models.EventAnswer) {
+		if event != nil {
+			batch.HandleButtonCallback(eventData, *event)
+		}
+	}
+
+	switch command.Cmd {
+	case commandWeather:
+		city := command.Arg("city")
+		if _, ok := weatherCities[city]; !ok {
+			log.Println("Weather requested for an unknown city:", city)
+			return
+		}
+		sent, ok := lastWeatherMessage(messages, peerID, event)
+		if !ok {
+			sendWeather(ctx, myBot, city, peerID, messages)
+			return
+		}
+		cities, err := weatherKeyboard()
+		if err != nil {
+			log.Println("Error building the weather keyboard:", err)
+			return
+		}
+		if err := myBot.EditLastMessage(ctx, weatherMessage(myBot, city), sent, cities); err != nil {
+			logAPIError(err)
+		}
+	case commandTime:
+		bookingTime := command.Arg("time")
+		confirmation, err := confirmationKeyboard(bookingTime)
+		if err != nil {
+			log.Println("Error building the confirmation keyboard:", err)
+			return
+		}
+		answer(models.EventAnswer{Type: "show_snackbar", Text: "Время подтверждено!"})
+		batch.SendMessageToServer(fmt.Sprintf("Подтвердить бронь на %s?", bookingTime), peerID, confirmation, nil)
+		executeBatch(ctx, batch)
+	case commandConfirm:
+		answer(models.EventAnswer{Type: "show_snackbar", Text: "Ваша заявка принята! \nМенеджер свяжется с вами в течение часа для потверждения брони."})
+		// the booking is done, hide the menu until the user starts over
+		batch.SendMessageToServer(fmt.Sprintf("Вы сделали заявку на %s, ождидайте звонка менеджера.", command.Arg("time")), peerID, models.Keyboard{}, nil, bot.RemoveKeyboard())
+		executeBatch(ctx, batch)
+	case commandBack:
+		menu, err := menuKeyboard()
+		if err != nil {
+			log.Println("Error building the menu keyboard:", err)
+			return
 		}
+		answer(models.EventAnswer{Type: "show_snackbar", Text: "Вы вернулись назад."})
+		batch.SendMessageToServer("Привет! Этот бот был сделан для VK \n Выбери что-то из кнопок снизу:", peerID, menu, nil)
+		executeBatch(ctx, batch)
 	}
 }
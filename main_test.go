@@ -0,0 +1,55 @@
+package main
+
+import (
+	"goVkBot/internal/bot"
+	"goVkBot/internal/models"
+	"testing"
+	"time"
+)
+
+func TestLastWeatherMessage(t *testing.T) {
+	messages := bot.NewMessageRegistry(10, time.Minute)
+	messages.Remember("weather", models.SentMessage{PeerID: 1, MessageID: 5, ConversationMessageID: 3})
+
+	tests := []struct {
+		name   string
+		peerID int
+		event  *models.MessageEvent
+		want   models.SentMessage
+		wantOk bool
+	}{
+		{
+			// an older weather message may be pressed after a newer one was sent
+			name:   "callback button",
+			peerID: 1,
+			event:  &models.MessageEvent{PeerID: 1, ConversationMessageID: 2},
+			want:   models.SentMessage{PeerID: 1, ConversationMessageID: 2},
+			wantOk: true,
+		},
+		{
+			name:   "callback button after a restart",
+			peerID: 2,
+			event:  &models.MessageEvent{PeerID: 2, ConversationMessageID: 7},
+			want:   models.SentMessage{PeerID: 2, ConversationMessageID: 7},
+			wantOk: true,
+		},
+		{
+			name:   "text button",
+			peerID: 1,
+			want:   models.SentMessage{PeerID: 1, MessageID: 5, ConversationMessageID: 3},
+			wantOk: true,
+		},
+		{
+			name:   "text button without a remembered message",
+			peerID: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := lastWeatherMessage(messages, test.peerID, test.event)
+			if got != test.want || ok != test.wantOk {
+				t.Errorf("lastWeatherMessage = %+v, %v, want %+v, %v", got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}